@@ -0,0 +1,79 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ColorMode controls whether the pretty encoder uses ANSI colors.
+type ColorMode string
+
+const (
+	// ColorAuto uses colors when writing to a terminal, while respecting
+	// the NO_COLOR and FORCE_COLOR conventions.
+	ColorAuto ColorMode = "auto"
+	// ColorAlways always uses colors.
+	ColorAlways ColorMode = "always"
+	// ColorNever never uses colors.
+	ColorNever ColorMode = "never"
+)
+
+// ParseColorMode parses a ColorMode. An empty string is ColorAuto.
+func ParseColorMode(text string) (ColorMode, error) {
+	switch mode := ColorMode(strings.ToLower(strings.TrimSpace(text))); mode {
+	case "":
+		return ColorAuto, nil
+	case ColorAuto, ColorAlways, ColorNever:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unrecognized color mode: %q", text)
+	}
+}
+
+// DetectColorMode returns the ColorMode based on the PS_LOG_COLOR env var,
+// which is one of auto, always or never. Defaults to auto.
+func DetectColorMode() ColorMode {
+	mode, err := ParseColorMode(os.Getenv("PS_LOG_COLOR"))
+	if err != nil {
+		panic("Invalid PS_LOG_COLOR value: " + os.Getenv("PS_LOG_COLOR"))
+	}
+	return mode
+}
+
+// useColor resolves the ColorMode for an output, which is a terminal if
+// isTerminal is set.
+//
+// With ColorAuto, FORCE_COLOR enables colors, unless it's set to 0 or false,
+// and NO_COLOR disables them, see https://no-color.org. Otherwise colors are
+// only used for terminals.
+func (mode ColorMode) useColor(isTerminal bool) bool {
+	switch mode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if v, ok := os.LookupEnv("FORCE_COLOR"); ok {
+		switch strings.ToLower(v) {
+		case "0", "false":
+			return false
+		default:
+			return true
+		}
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return isTerminal
+}
+
+// isTerminal reports whether f is a terminal, or at least a character
+// device, which is as close as we can get without platform specific ioctls.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
@@ -1,7 +1,11 @@
 package log
 
 import (
+	"errors"
 	"os"
+	"sync"
+	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,16 +19,25 @@ func NewPlanetScaleConfigDefault() Config {
 
 // NewPlanetScaleConfig creates a zap.Config with the desired encoding and Level.
 func NewPlanetScaleConfig(encoding string, level Level) Config {
-	// only buffer the JSON encoder
-	buffered := encoding == JSONEncoding
+	// only buffer the machine readable encoders
+	buffered := encoding != PrettyEncoding
 	// override buffering if it's set explicitly
 	if v, isSet := DetectBuffering(); isSet {
 		buffered = v
 	}
 	return Config{
-		Level:    zap.NewAtomicLevelAt(level),
-		Encoding: encoding,
-		Buffered: buffered,
+		Level:            zap.NewAtomicLevelAt(level),
+		NamedLevels:      DetectNamedLevels(),
+		Encoding:         encoding,
+		Buffered:         buffered,
+		FlushOnSignal:    DetectFlushOnSignal(),
+		Sampling:         DetectSampling(),
+		Color:            DetectColorMode(),
+		Time:             DetectTimeMode(),
+		Theme:            DetectTheme(),
+		Layout:           DetectLayout(),
+		OutputPaths:      DetectOutputPaths(),
+		ErrorOutputPaths: DetectErrorOutputPaths(),
 	}
 }
 
@@ -43,56 +56,336 @@ var defaultEncoderConfig = zapcore.EncoderConfig{
 	EncodeCaller:   zapcore.ShortCallerEncoder,
 }
 
+// gcpEncoderConfig is the EncoderConfig for GCPEncoding. The caller is
+// written as a source location object by the GCP profile instead.
+var gcpEncoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "timestamp",
+	LevelKey:       "severity",
+	NameKey:        "logger",
+	CallerKey:      zapcore.OmitKey,
+	FunctionKey:    zapcore.OmitKey,
+	MessageKey:     "message",
+	StacktraceKey:  "stacktrace",
+	LineEnding:     zapcore.DefaultLineEnding,
+	EncodeLevel:    gcpSeverityEncoder,
+	EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+	EncodeDuration: zapcore.MillisDurationEncoder,
+}
+
+// ecsEncoderConfig is the EncoderConfig for ECSEncoding. The caller is
+// written as the log.origin fields by the ECS profile instead.
+var ecsEncoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "@timestamp",
+	LevelKey:       "log.level",
+	NameKey:        "log.logger",
+	CallerKey:      zapcore.OmitKey,
+	FunctionKey:    zapcore.OmitKey,
+	MessageKey:     "message",
+	StacktraceKey:  "error.stack_trace",
+	LineEnding:     zapcore.DefaultLineEnding,
+	EncodeLevel:    zapcore.LowercaseLevelEncoder,
+	EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+	EncodeDuration: zapcore.MillisDurationEncoder,
+}
+
+// datadogEncoderConfig is the EncoderConfig for DatadogEncoding.
+var datadogEncoderConfig = zapcore.EncoderConfig{
+	TimeKey:        "timestamp",
+	LevelKey:       "status",
+	NameKey:        "logger.name",
+	CallerKey:      "caller",
+	FunctionKey:    zapcore.OmitKey,
+	MessageKey:     "message",
+	StacktraceKey:  "error.stack",
+	LineEnding:     zapcore.DefaultLineEnding,
+	EncodeLevel:    datadogStatusEncoder,
+	EncodeTime:     zapcore.RFC3339NanoTimeEncoder,
+	EncodeDuration: zapcore.MillisDurationEncoder,
+	EncodeCaller:   zapcore.ShortCallerEncoder,
+}
+
+// newPrettyEncoderConfig returns the defaultEncoderConfig for the pretty
+// encoder, which leaves durations and times to be formatted as Go does,
+// since neither milliseconds nor RFC3339 are particularly pretty.
+func newPrettyEncoderConfig() zapcore.EncoderConfig {
+	cfg := defaultEncoderConfig
+	cfg.EncodeDuration = nil
+	cfg.EncodeTime = nil
+	return cfg
+}
+
 // Config is our logging configration
 type Config struct {
-	Level    zap.AtomicLevel
+	Level zap.AtomicLevel
+	// NamedLevels, if set, overrides Level for named loggers.
+	NamedLevels *NamedLevels
+
 	Encoding string
+	// Color controls whether the pretty encoder uses colors. Defaults to
+	// ColorAuto.
+	Color ColorMode
+	// Time controls how the pretty encoder displays the time of each
+	// entry. Defaults to TimeElapsed.
+	Time TimeMode
+	// Theme is the Theme used by the pretty encoder. Defaults to ThemeDark.
+	Theme *Theme
+	// Layout controls how the pretty encoder lays out each entry. Defaults
+	// to LayoutCompact.
+	Layout Layout
+	// MessageWidth is the width messages are padded to with LayoutAligned.
+	// Defaults to 40.
+	MessageWidth int
+
 	Buffered bool
 	NanoTime bool
+
+	// BufferSize is the size in bytes of the buffer when Buffered is
+	// set. Defaults to 256kB.
+	BufferSize int
+	// FlushInterval is how often the buffer is flushed when Buffered is
+	// set. Defaults to 30 seconds.
+	FlushInterval time.Duration
+	// FlushOnSignal flushes and closes the outputs when the process
+	// receives SIGINT or SIGTERM, before letting the signal terminate it.
+	// This is only for processes which don't handle those signals
+	// themselves.
+	FlushOnSignal bool
+
+	// OutputPaths is a list of URLs or file paths to write logs to, as
+	// understood by zap.Open, such as "stdout", "stderr" or
+	// "file:///var/log/app.log". Logs are written to stderr if empty.
+	OutputPaths []string
+	// ErrorOutputPaths is a list of URLs or file paths to write internal
+	// logger errors to. These go to the same place as logs if empty.
+	ErrorOutputPaths []string
+
+	// Output, if set, is written to instead of OutputPaths. This allows
+	// logging to an arbitrary io.Writer by wrapping it with zapcore.AddSync.
+	// It's locked with zapcore.Lock, so it needn't be safe for concurrent
+	// use.
+	Output zapcore.WriteSyncer
+	// ErrorOutput, if set, is written to instead of ErrorOutputPaths.
+	ErrorOutput zapcore.WriteSyncer
+
+	// Sampling, if set, samples repeated entries.
+	Sampling *SamplingConfig
+
+	// Syslog, if set, also sends logs to syslog.
+	Syslog *SyslogConfig
+	// Journal, if set, also sends logs to systemd-journald.
+	Journal *JournalConfig
+
+	// GCPProjectID is the ID of the Google Cloud project that traces are
+	// in, for GCPEncoding. Defaults to the GOOGLE_CLOUD_PROJECT env var.
+	GCPProjectID string
+	// Datadog identifies the service for DatadogEncoding.
+	Datadog DatadogConfig
 }
 
 // Build creates a Logger out of our Config.
-// Note that this returns an error, but this doesn't actually
-// error. This is maintained for compatibility with
-// zapcore.Config{}.Build().
+// An error is returned if any of the output paths can't be opened.
+//
+// When Buffered, the buffer is flushed by a background goroutine which
+// is never stopped. This is fine for a logger which lives as long as
+// the process, otherwise use BuildWithCloser.
 func (cfg Config) Build(opts ...zap.Option) (*Logger, error) {
-	var ws zapcore.WriteSyncer = os.Stderr
-	// XXX: the internal BufferedWriteSyncer in theory
-	// leaks a goroutine for the ticker to flush to stderr,
-	// but in practice, this shouldn't particularly be a concern
-	// since there we shouldn't be needing to create and destroy
-	// loggers at runtime. If this becomes an actual issue
-	// we might need to expose a way to get this
-	// BufferedWriteSyncer so the caller can call Stop() on it.
-	if cfg.Buffered {
-		ws = &zapcore.BufferedWriteSyncer{WS: ws}
+	log, _, err := cfg.BuildWithCloser(opts...)
+	return log, err
+}
+
+// BuildWithCloser creates a Logger out of our Config, along with a function
+// to close it. Closing flushes and stops the buffer, if Buffered, and
+// closes any outputs opened from OutputPaths or ErrorOutputPaths. The
+// close function is safe to call more than once.
+func (cfg Config) BuildWithCloser(opts ...zap.Option) (*Logger, func() error, error) {
+	s, err := cfg.openSinks()
+	if err != nil {
+		return nil, nil, err
 	}
 	log := zap.New(
-		zapcore.NewCore(
-			cfg.buildEncoder(),
-			ws,
-			cfg.Level,
-		),
-		zap.ErrorOutput(ws),
+		cfg.buildCore(s),
+		zap.ErrorOutput(s.errOut),
 		zap.AddCaller(),
 		zap.AddStacktrace(ErrorLevel),
+		zap.WithFatalHook(s),
 	)
 	if len(opts) > 0 {
 		log = log.WithOptions(opts...)
 	}
-	return log, nil
+	return log, s.Close, nil
 }
 
-func (cfg Config) buildEncoder() zapcore.Encoder {
-	encoderConfig := defaultEncoderConfig
-	// we only suppport pretty or json
-	if cfg.Encoding == PrettyEncoding {
-		return NewPrettyEncoder(encoderConfig)
+// sinks are the opened outputs of a Config.
+type sinks struct {
+	out    zapcore.WriteSyncer
+	errOut zapcore.WriteSyncer
+	// isTerminal is set if out is known to be a terminal.
+	isTerminal bool
+	// width is the width of the terminal, if out is one, and it's known.
+	width int
+
+	// closers are run in reverse order by Close, so anything opened
+	// after the outputs is closed while they're still writable.
+	closers []func()
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Close stops and flushes the buffer, if there is one, closes the outputs,
+// and stops anything else started alongside them. It's safe to call Close more than once.
+func (s *sinks) Close() error {
+	s.closeOnce.Do(func() {
+		for i := len(s.closers) - 1; i >= 0; i-- {
+			s.closers[i]()
+		}
+	})
+	return s.closeErr
+}
+
+// isUnsyncableError reports whether err is from calling Sync on a file which
+// doesn't support it, such as stderr when it's a pipe or terminal.
+func isUnsyncableError(err error) bool {
+	return err == nil || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOTTY)
+}
+
+// stdFile returns stdout or stderr if paths only refers to one of them.
+func stdFile(paths []string) *os.File {
+	if len(paths) != 1 {
+		return nil
+	}
+	switch paths[0] {
+	case "stdout":
+		return os.Stdout
+	case "stderr":
+		return os.Stderr
+	}
+	return nil
+}
+
+// setTerminal records whether f, which out writes to, is a terminal, and
+// if so its width. f may be nil if it isn't known.
+func (s *sinks) setTerminal(f *os.File) {
+	s.isTerminal = f != nil && isTerminal(f)
+	s.width = 0
+	if s.isTerminal {
+		s.width = terminalWidth(f)
+	}
+}
+
+// openSinks opens the WriteSyncers for logs, and for internal errors.
+func (cfg Config) openSinks() (*sinks, error) {
+	s := &sinks{out: os.Stderr}
+	s.setTerminal(os.Stderr)
+	switch {
+	case cfg.Output != nil:
+		s.out = zapcore.Lock(cfg.Output)
+		f, _ := cfg.Output.(*os.File)
+		s.setTerminal(f)
+	case len(cfg.OutputPaths) > 0:
+		out, close, err := zap.Open(cfg.OutputPaths...)
+		if err != nil {
+			return nil, err
+		}
+		s.out = out
+		s.closers = append(s.closers, close)
+		s.setTerminal(stdFile(cfg.OutputPaths))
+	}
+	if cfg.Buffered {
+		buffered := &zapcore.BufferedWriteSyncer{
+			WS:            s.out,
+			Size:          cfg.BufferSize,
+			FlushInterval: cfg.FlushInterval,
+		}
+		s.out = buffered
+		s.closers = append(s.closers, func() {
+			if err := buffered.Stop(); !isUnsyncableError(err) {
+				s.closeErr = err
+			}
+		})
+	}
+
+	s.errOut = s.out
+	switch {
+	case cfg.ErrorOutput != nil:
+		s.errOut = zapcore.Lock(cfg.ErrorOutput)
+	case len(cfg.ErrorOutputPaths) > 0:
+		errOut, close, err := zap.Open(cfg.ErrorOutputPaths...)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.errOut = errOut
+		s.closers = append(s.closers, close)
+	}
+
+	if cfg.FlushOnSignal {
+		s.flushOnSignal()
+	}
+	return s, nil
+}
+
+func (cfg Config) buildCore(s *sinks) zapcore.Core {
+	newCore := func(enab zapcore.LevelEnabler) zapcore.Core {
+		core := zapcore.NewCore(
+			cfg.buildEncoder(s),
+			s.out,
+			enab,
+		)
+		if cfg.Syslog != nil {
+			syslog, close := NewSyslogCore(*cfg.Syslog, enab)
+			s.closers = append(s.closers, func() { close() })
+			core = zapcore.NewTee(core, syslog)
+		}
+		if cfg.Journal != nil {
+			journal, close := NewJournalCore(*cfg.Journal, enab)
+			s.closers = append(s.closers, func() { close() })
+			core = zapcore.NewTee(core, journal)
+		}
+		if cfg.Sampling != nil {
+			core = cfg.Sampling.wrap(core, s)
+		}
+		return core
+	}
+	if cfg.NamedLevels != nil {
+		return newNamedLevelCore(cfg.Level, cfg.NamedLevels, newCore)
+	}
+	return newCore(cfg.Level)
+}
+
+func (cfg Config) buildEncoder(s *sinks) zapcore.Encoder {
+	// we only suppport pretty, logfmt, gcp, ecs, datadog or json
+	switch cfg.Encoding {
+	case PrettyEncoding:
+		opts := []PrettyOption{
+			PrettyColor(cfg.Color.useColor(s.isTerminal)),
+			PrettyTime(cfg.Time),
+			PrettyTheme(cfg.Theme),
+		}
+		if cfg.Layout == LayoutAligned {
+			opts = append(opts, PrettyAligned(cfg.MessageWidth, s.width))
+		}
+		return NewPrettyEncoder(newPrettyEncoderConfig(), opts...)
+	case GCPEncoding:
+		projectID := cfg.GCPProjectID
+		if projectID == "" {
+			projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+		}
+		return NewGCPEncoder(projectID)
+	case ECSEncoding:
+		return NewECSEncoder()
+	case DatadogEncoding:
+		return NewDatadogEncoder(cfg.Datadog.withEnv())
 	}
-	// NanoTime only applies when not using the pretty encoder, since
-	// nanosecond timestamps are, in fact, not pretty.
+	encoderConfig := defaultEncoderConfig
+	// NanoTime only applies to the JSON and logfmt encoders, since
+	// nanosecond timestamps are, in fact, not pretty, and the profiles for
+	// other services use the timestamp formats they expect.
 	if cfg.NanoTime {
 		encoderConfig.EncodeTime = zapcore.EpochNanosTimeEncoder
 	}
-	return zapcore.NewJSONEncoder(encoderConfig)
+	if cfg.Encoding == LogfmtEncoding {
+		return NewLogfmtEncoder(encoderConfig)
+	}
+	return newProfileEncoder(encoderConfig, &profile{})
 }
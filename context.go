@@ -0,0 +1,49 @@
+package log
+
+import (
+	"context"
+	"sync"
+)
+
+type contextKey struct{}
+
+var (
+	defaultLogger     *Logger
+	defaultLoggerOnce sync.Once
+)
+
+// Default returns the package level Logger, which is lazily created with New
+// the first time it's needed. This is the Logger returned by FromContext when
+// a context doesn't carry one.
+func Default() *Logger {
+	defaultLoggerOnce.Do(func() {
+		defaultLogger = New()
+	})
+	return defaultLogger
+}
+
+// WithContext returns a copy of ctx which carries logger. The logger can be
+// retrieved again with FromContext.
+func WithContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the Logger carried by ctx. If ctx doesn't carry a
+// Logger, the Default Logger is returned, so this never returns nil.
+func FromContext(ctx context.Context) *Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*Logger); ok && logger != nil {
+		return logger
+	}
+	return Default()
+}
+
+// WithFields returns a copy of ctx which carries a Logger with fields
+// added to it. This allows request scoped fields, such as org or database
+// IDs, to be attached once and picked up with FromContext further down the
+// call stack.
+func WithFields(ctx context.Context, fields ...Field) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	return WithContext(ctx, FromContext(ctx).With(fields...))
+}
@@ -2,9 +2,14 @@
 package log
 
 import (
+	"bytes"
 	"fmt"
+	"math"
+	"os"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.uber.org/zap"
@@ -23,24 +28,153 @@ func getEncoder() *prettyEncoder {
 }
 
 func putEncoder(enc *prettyEncoder) {
+	enc.EncoderConfig = nil
+	enc.opts = nil
 	enc.buf = nil
+	enc.namespace = ""
+	enc.depth = 0
+	enc.blocks = nil
+	enc.fieldStarts = enc.fieldStarts[:0]
 	_encPool.Put(enc)
 }
 
 type prettyEncoder struct {
+	*zapcore.EncoderConfig
+	opts  *prettyOptions
 	start time.Time
 	buf   *buffer.Buffer
+	// namespace is the prefix for keys from any open namespaces, such as
+	// "http." after OpenNamespace("http").
+	namespace string
+	// depth is how many arrays and objects are currently open.
+	depth int
+	// blocks are multi-line strings which are written as indented blocks
+	// after the rest of the entry.
+	blocks []prettyBlock
+	// unquoted is set while writing a column, which is clear enough without
+	// quotes around strings.
+	unquoted bool
+	// fieldStarts are the offsets of each top level field in buf, for
+	// wrapping them with LayoutAligned.
+	fieldStarts []int
+	// visiting holds the pointers, maps and slices a reflected value is
+	// being written from, to stop at any which refer to themselves.
+	visiting map[visitKey]bool
+}
+
+// prettyOptions are the options set with each PrettyOption.
+type prettyOptions struct {
+	// last is the time of the previous entry, in unix nanoseconds, for
+	// TimeDelta. It's first to keep it aligned for atomic operations.
+	last int64
+
+	color    bool
+	timeMode TimeMode
+	theme    *Theme
+
+	// maxDepth and maxLength limit how much of a reflected value is
+	// written, see PrettyReflectLimits.
+	maxDepth  int
+	maxLength int
+
+	// aligned, messageWidth and wrap are set by PrettyAligned.
+	aligned      bool
+	messageWidth int
+	wrap         int
+}
+
+// PrettyOption configures the pretty encoder.
+type PrettyOption func(*prettyOptions)
+
+// PrettyColor sets whether the pretty encoder uses ANSI colors. Colors are
+// enabled by default.
+func PrettyColor(enabled bool) PrettyOption {
+	return func(opts *prettyOptions) {
+		opts.color = enabled
+	}
+}
+
+// PrettyTime sets how the pretty encoder displays the time of each entry.
+// Defaults to TimeElapsed.
+func PrettyTime(mode TimeMode) PrettyOption {
+	return func(opts *prettyOptions) {
+		opts.timeMode = mode
+	}
+}
+
+// PrettyTheme sets the Theme used by the pretty encoder. Defaults to
+// ThemeDark.
+func PrettyTheme(theme *Theme) PrettyOption {
+	return func(opts *prettyOptions) {
+		if theme != nil {
+			opts.theme = theme
+		}
+	}
+}
+
+// PrettyReflectLimits limits how much of a value logged with Any or Reflect
+// the pretty encoder writes. Structs, maps and slices nested more than depth
+// levels deep are elided, as are the elements of maps and slices after the
+// first length. A limit of zero or less disables it. Defaults to a depth of
+// 8 and a length of 100. Either way, values which refer to themselves are
+// written as <cycle> where they recur.
+func PrettyReflectLimits(depth, length int) PrettyOption {
+	return func(opts *prettyOptions) {
+		opts.maxDepth = depth
+		opts.maxLength = length
+	}
+}
+
+// PrettyAligned enables LayoutAligned, padding messages to messageWidth, or 40
+// if it's zero or less. When wrap is greater than zero, fields which would
+// extend a line past wrap columns are moved onto a continuation line.
+func PrettyAligned(messageWidth, wrap int) PrettyOption {
+	return func(opts *prettyOptions) {
+		if messageWidth <= 0 {
+			messageWidth = defaultMessageWidth
+		}
+		opts.aligned = true
+		opts.messageWidth = messageWidth
+		opts.wrap = wrap
+	}
 }
 
-func NewPrettyEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+// NewPrettyEncoder creates a human friendly, colorized, encoder.
+//
+// Keys set to zapcore.OmitKey in cfg are omitted, and the configured caller,
+// duration, time and name encoders are used. When EncodeDuration or
+// EncodeTime are nil, durations and times are formatted as Go does, and the
+// time of each entry is displayed according to PrettyTime.
+func NewPrettyEncoder(cfg zapcore.EncoderConfig, opts ...PrettyOption) zapcore.Encoder {
+	if cfg.LineEnding == "" {
+		cfg.LineEnding = zapcore.DefaultLineEnding
+	}
+	theme := ThemeDark
+	o := &prettyOptions{
+		color:    true,
+		timeMode: TimeElapsed,
+		theme:    &theme,
+
+		maxDepth:  8,
+		maxLength: 100,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	start := time.Now()
+	o.last = start.UnixNano()
 	return &prettyEncoder{
-		start: time.Now(),
-		buf:   bufferpool.Get(),
+		EncoderConfig: &cfg,
+		opts:          o,
+		start:         start,
+		buf:           bufferpool.Get(),
 	}
 }
 
 func (enc *prettyEncoder) clone() *prettyEncoder {
 	clone := getEncoder()
+	clone.EncoderConfig = enc.EncoderConfig
+	clone.opts = enc.opts
 	clone.start = enc.start
 	clone.buf = bufferpool.Get()
 	return clone
@@ -49,95 +183,188 @@ func (enc *prettyEncoder) clone() *prettyEncoder {
 func (enc *prettyEncoder) Clone() zapcore.Encoder {
 	clone := enc.clone()
 	clone.buf.Write(enc.buf.Bytes())
+	clone.namespace = enc.namespace
+	clone.blocks = append(clone.blocks, enc.blocks...)
+	clone.fieldStarts = append(clone.fieldStarts, enc.fieldStarts...)
 	return clone
 }
 
-func (enc *prettyEncoder) addAttribute(as ...attribute) {
+// startStyle starts writing text in style s, and returns whether endStyle
+// needs to be called once the text has been written.
+func (enc *prettyEncoder) startStyle(s Style) bool {
+	if !enc.opts.color || s == "" {
+		return false
+	}
 	enc.buf.AppendString(escape)
 	enc.buf.AppendByte('[')
-	first := true
-	for _, a := range as {
-		if first {
-			first = false
-		} else {
-			enc.buf.AppendByte(';')
-		}
-		enc.buf.AppendInt(int64(a))
+	enc.buf.AppendString(string(s))
+	enc.buf.AppendByte('m')
+	return true
+}
+
+func (enc *prettyEncoder) endStyle(started bool) {
+	if !started {
+		return
 	}
+	enc.buf.AppendString(escape)
+	enc.buf.AppendByte('[')
+	enc.buf.AppendInt(int64(attributeReset))
 	enc.buf.AppendByte('m')
 }
 
 func (enc *prettyEncoder) addKey(key string) {
-	enc.buf.AppendByte(' ')
-	enc.addAttribute(attributeFgGreen)
+	if enc.depth == 0 && enc.opts.aligned {
+		enc.fieldStarts = append(enc.fieldStarts, enc.buf.Len())
+	}
+	// Keys are separated by spaces, except for the first in an object.
+	if b := trimTrailingStyles(enc.buf.Bytes()); len(b) == 0 || b[len(b)-1] != '{' {
+		enc.buf.AppendByte(' ')
+	}
+	styled := enc.startStyle(enc.opts.theme.Key)
+	enc.buf.AppendString(enc.namespace)
 	enc.buf.AppendString(key)
-	enc.addAttribute(attributeReset)
+	enc.endStyle(styled)
 	enc.buf.AppendByte('=')
 }
 
 func (enc *prettyEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
 	final := enc.clone()
 
-	final.addAttribute(attributeFgWhite)
-	fmt.Fprintf(final.buf, "%13s", time.Since(final.start))
-	final.addAttribute(attributeReset)
+	if final.TimeKey != zapcore.OmitKey {
+		styled := final.startStyle(final.opts.theme.Time)
+		final.addEntryTime(ent.Time)
+		final.endStyle(styled)
+		final.buf.AppendByte(' ')
+	}
 
-	final.buf.AppendString(" |")
+	if final.LevelKey != zapcore.OmitKey {
+		final.buf.AppendByte('|')
+		styled := final.startStyle(final.opts.theme.level(ent.Level))
+		final.buf.AppendString(strings.ToUpper(ent.Level.String())[:4])
+		final.endStyle(styled)
+		final.buf.AppendString("| ")
+	}
 
-	switch ent.Level {
-	case DebugLevel:
-		final.addAttribute(attributeFgMagenta)
-	case InfoLevel:
-		final.addAttribute(attributeFgCyan)
-	case WarnLevel:
-		final.addAttribute(attributeFgYellow)
-	case ErrorLevel:
-		final.addAttribute(attributeFgRed)
-	case DPanicLevel, PanicLevel:
-		final.addAttribute(attributeBgRed)
-	case FatalLevel:
-		final.addAttribute(attributeBgHiRed, attributeFgHiWhite)
+	// Continuation lines of wrapped fields are indented to line up with the
+	// message.
+	msgStart := final.buf.Len()
+	if final.MessageKey != zapcore.OmitKey {
+		styled := final.startStyle(final.opts.theme.Message)
+		final.buf.AppendString(ent.Message)
+		final.endStyle(styled)
+		if final.opts.aligned {
+			final.pad(msgStart, final.opts.messageWidth)
+		}
 	}
-	final.buf.AppendString(strings.ToUpper(ent.Level.String())[:4])
-	final.addAttribute(attributeReset)
-	final.buf.AppendByte('|')
 
-	final.buf.AppendByte(' ')
-	final.buf.AppendString(ent.Message)
+	nameEncoder := final.EncodeName
+	if nameEncoder == nil {
+		nameEncoder = zapcore.FullNameEncoder
+	}
+	callerEncoder := final.EncodeCaller
+	if callerEncoder == nil {
+		callerEncoder = zapcore.ShortCallerEncoder
+	}
 
-	if ent.LoggerName != "" {
-		final.AddString("logger", ent.LoggerName)
+	if final.NameKey != zapcore.OmitKey {
+		switch {
+		case final.opts.aligned:
+			// Unnamed loggers leave the column empty, to keep the
+			// rest aligned.
+			final.addColumn(nameColumnWidth, "", func() {
+				if ent.LoggerName != "" {
+					nameEncoder(ent.LoggerName, final)
+				}
+			})
+		case ent.LoggerName != "":
+			final.addKey(final.NameKey)
+			nameEncoder(ent.LoggerName, final)
+		}
 	}
 
 	if ent.Caller.Defined {
-		final.addKey("caller")
-		zapcore.ShortCallerEncoder(ent.Caller, final)
+		if final.CallerKey != zapcore.OmitKey {
+			if final.opts.aligned {
+				final.addColumn(callerColumnWidth, final.opts.theme.Caller, func() {
+					callerEncoder(ent.Caller, final)
+				})
+			} else {
+				final.addKey(final.CallerKey)
+				styled := final.startStyle(final.opts.theme.Caller)
+				callerEncoder(ent.Caller, final)
+				final.endStyle(styled)
+			}
+		}
+		if final.FunctionKey != zapcore.OmitKey {
+			final.AddString(final.FunctionKey, ent.Caller.Function)
+		}
 	}
 
 	// Write prior fields accumulated from `With()` calls first before writing our new fields.
+	for _, start := range enc.fieldStarts {
+		final.fieldStarts = append(final.fieldStarts, final.buf.Len()+start)
+	}
 	final.buf.Write(enc.buf.Bytes())
+	// New fields go into any namespaces opened by `With()` calls.
+	final.namespace = enc.namespace
+	final.blocks = append(final.blocks, enc.blocks...)
 
 	addFields(final, fields)
 
-	if ent.Stack != "" && ent.Level != PanicLevel {
-		final.buf.AppendByte(' ')
-		final.addAttribute(attributeFgRed)
-		final.buf.AppendString("stacktrace")
-		final.addAttribute(attributeReset)
-		final.buf.AppendString("=\n")
-		final.buf.AppendString(ent.Stack)
+	if final.opts.aligned {
+		final.wrapFields(visibleWidth(final.buf.Bytes()[:msgStart]))
+		final.trimTrailingSpaces()
+	}
+
+	for _, b := range final.blocks {
+		final.addBlock(b)
+	}
+
+	if ent.Stack != "" && ent.Level != PanicLevel && final.StacktraceKey != zapcore.OmitKey {
+		final.addStacktrace(ent.Stack)
 	}
 
-	final.buf.AppendByte('\n')
+	final.buf.AppendString(final.LineEnding)
 
 	ret := final.buf
 	putEncoder(final)
 	return ret, nil
 }
 
+// addEntryTime writes the time of an entry with EncodeTime, if it's set, or
+// otherwise according to the TimeMode.
+func (enc *prettyEncoder) addEntryTime(t time.Time) {
+	if e := enc.EncodeTime; e != nil {
+		cur := enc.buf.Len()
+		enc.unquoted = true
+		e(t, enc)
+		enc.unquoted = false
+		if cur != enc.buf.Len() {
+			return
+		}
+	}
+	switch enc.opts.timeMode {
+	case TimeLocal:
+		fmt.Fprintf(enc.buf, "%13s", t.Local().Format(wallClockFormat))
+	case TimeUTC:
+		fmt.Fprintf(enc.buf, "%13s", t.UTC().Format(wallClockFormat+"Z"))
+	case TimeDelta:
+		last := atomic.SwapInt64(&enc.opts.last, t.UnixNano())
+		fmt.Fprintf(enc.buf, "%13s", "+"+time.Duration(t.UnixNano()-last).String())
+	default:
+		fmt.Fprintf(enc.buf, "%13s", time.Since(enc.start))
+	}
+}
+
 func init() {
+	// Encoders registered with zap aren't told where they're writing to,
+	// so colors are detected as if it's stderr, which is zap's default.
 	zap.RegisterEncoder(PrettyEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
-		return NewPrettyEncoder(cfg), nil
+		mode, err := ParseColorMode(os.Getenv("PS_LOG_COLOR"))
+		if err != nil {
+			return nil, err
+		}
+		return NewPrettyEncoder(cfg, PrettyColor(mode.useColor(isTerminal(os.Stderr)))), nil
 	})
 }
 
@@ -148,11 +375,12 @@ func addFields(enc zapcore.ObjectEncoder, fields []zapcore.Field) {
 }
 
 func (enc *prettyEncoder) addElementSeparator() {
-	last := enc.buf.Len() - 1
+	b := trimTrailingStyles(enc.buf.Bytes())
+	last := len(b) - 1
 	if last < 0 {
 		return
 	}
-	switch enc.buf.Bytes()[last] {
+	switch b[last] {
 	case '{', '[', ':', ',', '=', ' ':
 		return
 	default:
@@ -161,6 +389,24 @@ func (enc *prettyEncoder) addElementSeparator() {
 	}
 }
 
+// trimTrailingStyles trims any escape sequences written by startStyle from
+// the end of b, so they aren't mistaken for a previous element.
+func trimTrailingStyles(b []byte) []byte {
+	for len(b) > 0 && b[len(b)-1] == 'm' {
+		i := bytes.LastIndex(b, []byte(escape+"["))
+		if i < 0 {
+			return b
+		}
+		for _, c := range b[i+2 : len(b)-1] {
+			if c != ';' && (c < '0' || c > '9') {
+				return b
+			}
+		}
+		b = b[:i]
+	}
+	return b
+}
+
 func (enc *prettyEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
 	enc.addKey(key)
 	return enc.AppendArray(arr)
@@ -169,7 +415,9 @@ func (enc *prettyEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error
 func (enc *prettyEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
 	enc.addElementSeparator()
 	enc.buf.AppendByte('[')
+	enc.depth++
 	err := arr.MarshalLogArray(enc)
+	enc.depth--
 	enc.buf.AppendByte(']')
 	return err
 }
@@ -182,7 +430,14 @@ func (enc *prettyEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) err
 func (enc *prettyEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
 	enc.addElementSeparator()
 	enc.buf.AppendByte('{')
+	// Keys within an object are relative to it, and any namespaces opened
+	// within it are closed along with it.
+	namespace := enc.namespace
+	enc.namespace = ""
+	enc.depth++
 	err := obj.MarshalLogObject(enc)
+	enc.depth--
+	enc.namespace = namespace
 	enc.buf.AppendByte('}')
 	return err
 }
@@ -219,25 +474,78 @@ func (enc *prettyEncoder) AppendBool(value bool) {
 	}
 }
 
-func (enc *prettyEncoder) AddComplex128(key string, value complex128) { enc.AddReflected(key, value) }
-func (enc *prettyEncoder) AppendComplex128(value complex128)          { enc.AppendReflected(value) }
-func (enc *prettyEncoder) AddComplex64(key string, value complex64)   { enc.AddReflected(key, value) }
-func (enc *prettyEncoder) AppendComplex64(value complex64)            { enc.AppendReflected(value) }
+func (enc *prettyEncoder) AddComplex128(key string, value complex128) {
+	enc.addKey(key)
+	enc.AppendComplex128(value)
+}
+
+func (enc *prettyEncoder) AppendComplex128(value complex128) {
+	enc.appendComplex(value, 64)
+}
+
+func (enc *prettyEncoder) AddComplex64(key string, value complex64) {
+	enc.addKey(key)
+	enc.AppendComplex64(value)
+}
+
+func (enc *prettyEncoder) AppendComplex64(value complex64) {
+	enc.appendComplex(complex128(value), 32)
+}
+
+// appendComplex writes value like Go does, such as (1+2i), with each part
+// formatted with the precision of a float of size bitSize.
+func (enc *prettyEncoder) appendComplex(value complex128, bitSize int) {
+	enc.addElementSeparator()
+	enc.buf.AppendByte('(')
+	enc.buf.AppendFloat(real(value), bitSize)
+	if i := imag(value); i >= 0 || math.IsNaN(i) {
+		enc.buf.AppendByte('+')
+	}
+	enc.buf.AppendFloat(imag(value), bitSize)
+	enc.buf.AppendString("i)")
+}
+
 func (enc *prettyEncoder) AddDuration(key string, value time.Duration) {
 	enc.addKey(key)
 	enc.AppendDuration(value)
 }
 
 func (enc *prettyEncoder) AppendDuration(value time.Duration) {
-	enc.buf.AppendString(value.String())
+	cur := enc.buf.Len()
+	if e := enc.EncodeDuration; e != nil {
+		e(value, enc)
+	}
+	if cur == enc.buf.Len() {
+		// Fall back to Go's formatting if there's no encoder, or it was a
+		// no-op. An encoder adds its own separator through the Append
+		// methods it calls, so this is the only place we need one.
+		enc.addElementSeparator()
+		enc.buf.AppendString(value.String())
+	}
+}
+
+func (enc *prettyEncoder) AddFloat64(key string, value float64) {
+	enc.addKey(key)
+	enc.AppendFloat64(value)
+}
+
+func (enc *prettyEncoder) AppendFloat64(value float64) {
+	enc.addElementSeparator()
+	enc.buf.AppendFloat(value, 64)
+}
+
+func (enc *prettyEncoder) AddFloat32(key string, value float32) {
+	enc.addKey(key)
+	enc.AppendFloat32(value)
+}
+
+func (enc *prettyEncoder) AppendFloat32(value float32) {
+	enc.addElementSeparator()
+	enc.buf.AppendFloat(float64(value), 32)
 }
 
-func (enc *prettyEncoder) AddFloat64(key string, value float64) { enc.AddReflected(key, value) }
-func (enc *prettyEncoder) AppendFloat64(value float64)          { enc.AppendReflected(value) }
-func (enc *prettyEncoder) AddFloat32(key string, value float32) { enc.AddReflected(key, value) }
-func (enc *prettyEncoder) AppendFloat32(value float32)          { enc.AppendReflected(value) }
-func (enc *prettyEncoder) AddInt(key string, value int)         { enc.AddInt64(key, int64(value)) }
-func (enc *prettyEncoder) AppendInt(value int)                  { enc.AppendInt64(int64(value)) }
+func (enc *prettyEncoder) AddInt(key string, value int) { enc.AddInt64(key, int64(value)) }
+func (enc *prettyEncoder) AppendInt(value int)          { enc.AppendInt64(int64(value)) }
 
 func (enc *prettyEncoder) AddInt64(key string, value int64) {
 	enc.addKey(key)
@@ -246,7 +554,7 @@ func (enc *prettyEncoder) AddInt64(key string, value int64) {
 
 func (enc *prettyEncoder) AppendInt64(value int64) {
 	enc.addElementSeparator()
-	fmt.Fprintf(enc.buf, "%d", value)
+	enc.buf.AppendInt(value)
 }
 
 func (enc *prettyEncoder) AddInt32(key string, value int32) { enc.AddInt64(key, int64(value)) }
@@ -266,7 +574,7 @@ func (enc *prettyEncoder) AddUint64(key string, value uint64) {
 
 func (enc *prettyEncoder) AppendUint64(value uint64) {
 	enc.addElementSeparator()
-	fmt.Fprintf(enc.buf, "%d", value)
+	enc.buf.AppendUint(value)
 }
 
 func (enc *prettyEncoder) AddUint32(key string, value uint32)   { enc.AddUint64(key, uint64(value)) }
@@ -279,13 +587,25 @@ func (enc *prettyEncoder) AddUintptr(key string, value uintptr) { enc.AddUint64(
 func (enc *prettyEncoder) AppendUintptr(value uintptr)          { enc.AppendUint64(uint64(value)) }
 
 func (enc *prettyEncoder) AddString(key, value string) {
+	// Multi-line strings, such as the errorVerbose of an error with a
+	// stack, are unreadable when escaped onto a single line, so top level
+	// ones are written as a block after the rest of the entry instead.
+	if enc.depth == 0 && strings.Contains(value, "\n") {
+		enc.blocks = append(enc.blocks, prettyBlock{
+			key:   enc.namespace + key,
+			value: value,
+		})
+		return
+	}
 	enc.addKey(key)
 	enc.AppendString(value)
 }
 
 func (enc *prettyEncoder) AppendString(val string) {
 	enc.addElementSeparator()
-	enc.buf.AppendByte('"')
+	if !enc.unquoted {
+		enc.buf.AppendByte('"')
+	}
 	for i := 0; i < len(val); i++ {
 		b := val[i]
 		switch b {
@@ -295,11 +615,19 @@ func (enc *prettyEncoder) AppendString(val string) {
 			enc.buf.AppendString(`\t`)
 		case '\r':
 			enc.buf.AppendString(`\r`)
+		case '"', '\\':
+			// Quotes and backslashes only need escaping within quotes.
+			if !enc.unquoted {
+				enc.buf.AppendByte('\\')
+			}
+			enc.buf.AppendByte(b)
 		default:
 			enc.buf.AppendByte(val[i])
 		}
 	}
-	enc.buf.AppendByte('"')
+	if !enc.unquoted {
+		enc.buf.AppendByte('"')
+	}
 }
 
 func (enc *prettyEncoder) AddTime(key string, value time.Time) {
@@ -308,7 +636,14 @@ func (enc *prettyEncoder) AddTime(key string, value time.Time) {
 }
 
 func (enc *prettyEncoder) AppendTime(value time.Time) {
-	enc.buf.AppendString(value.Format(time.RFC3339))
+	cur := enc.buf.Len()
+	if e := enc.EncodeTime; e != nil {
+		e(value, enc)
+	}
+	if cur == enc.buf.Len() {
+		enc.addElementSeparator()
+		enc.buf.AppendString(value.Format(time.RFC3339))
+	}
 }
 
 // AddReflected uses reflection to serialize arbitrary objects, so it can be
@@ -319,23 +654,35 @@ func (enc *prettyEncoder) AddReflected(key string, value interface{}) error {
 }
 
 func (enc *prettyEncoder) AppendReflected(value interface{}) error {
-	enc.addElementSeparator()
-	fmt.Fprintf(enc.buf, "%#v", value)
-	return nil
+	return enc.appendValue(reflect.ValueOf(value), 0)
 }
 
 // OpenNamespace opens an isolated namespace where all subsequent fields will
 // be added. Applications can use namespaces to prevent key collisions when
 // injecting loggers into sub-components or third-party libraries.
-func (enc *prettyEncoder) OpenNamespace(key string) {}
+//
+// Keys within a namespace are prefixed with it, separated by a dot, such as
+// http.status=200.
+func (enc *prettyEncoder) OpenNamespace(key string) {
+	enc.namespace += key + "."
+}
 
 const escape = "\x1b"
 
 type attribute int
 
 // Base attributes
+//
+//nolint:deadcode,varcheck
 const (
 	attributeReset attribute = iota
+	attributeBold
+	attributeFaint
+	attributeItalic
+	attributeUnderline
+	attributeBlink
+	_
+	attributeReverse
 )
 
 // Foreground text colors
@@ -0,0 +1,118 @@
+package log
+
+import (
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// blockIndent is the indentation of a block's key, with its lines indented
+// twice as far.
+const blockIndent = "    "
+
+// prettyBlock is a multi-line string written by the pretty encoder after
+// the rest of an entry.
+type prettyBlock struct {
+	key   string
+	value string
+}
+
+// addBlockKey starts a block on a new line.
+func (enc *prettyEncoder) addBlockKey(key string, style Style) {
+	enc.buf.AppendString(enc.LineEnding)
+	enc.buf.AppendString(blockIndent)
+	styled := enc.startStyle(style)
+	enc.buf.AppendString(key)
+	enc.endStyle(styled)
+	enc.buf.AppendByte('=')
+}
+
+// addBlock writes b with each of its lines indented, and tabs expanded so
+// the indentation is consistent.
+func (enc *prettyEncoder) addBlock(b prettyBlock) {
+	enc.addBlockKey(b.key, enc.opts.theme.Key)
+	for _, line := range strings.Split(strings.TrimRight(b.value, "\n"), "\n") {
+		enc.buf.AppendString(enc.LineEnding)
+		enc.buf.AppendString(blockIndent + blockIndent)
+		line = strings.TrimSuffix(line, "\r")
+		enc.buf.AppendString(strings.ReplaceAll(line, "\t", blockIndent))
+	}
+}
+
+// addStacktrace writes a stacktrace, as formatted by zap, with each frame
+// indented. Frames from the standard library are dimmed, and frames from the
+// main module are highlighted, to make it easier to find the interesting
+// parts.
+func (enc *prettyEncoder) addStacktrace(stack string) {
+	enc.addBlockKey(enc.StacktraceKey, enc.opts.theme.Stacktrace)
+
+	var style Style
+	for _, line := range strings.Split(stack, "\n") {
+		enc.buf.AppendString(enc.LineEnding)
+		enc.buf.AppendString(blockIndent + blockIndent)
+		// zap writes each frame as the function on one line, and the
+		// file and line number on the next, indented by a tab.
+		if file := strings.TrimPrefix(line, "\t"); file != line {
+			enc.buf.AppendString(blockIndent)
+			line = file
+		} else {
+			style = enc.frameStyle(line)
+		}
+		styled := enc.startStyle(style)
+		enc.buf.AppendString(line)
+		enc.endStyle(styled)
+	}
+}
+
+func (enc *prettyEncoder) frameStyle(function string) Style {
+	switch pkg := functionPackage(function); {
+	case isMainModule(pkg):
+		return enc.opts.theme.StackModule
+	case isStdlib(pkg):
+		return enc.opts.theme.StackStdlib
+	}
+	return ""
+}
+
+// functionPackage returns the import path of the package from the name of a
+// function in a stacktrace, such as "net/http" from
+// "net/http.(*conn).serve".
+func functionPackage(function string) string {
+	slash := strings.LastIndexByte(function, '/')
+	if dot := strings.IndexByte(function[slash+1:], '.'); dot >= 0 {
+		return function[:slash+1+dot]
+	}
+	return function
+}
+
+// isStdlib reports whether pkg is in the standard library, which is the
+// case when the first element of its path isn't a domain.
+func isStdlib(pkg string) bool {
+	first := pkg
+	if i := strings.IndexByte(pkg, '/'); i >= 0 {
+		first = pkg[:i]
+	}
+	return !strings.Contains(first, ".")
+}
+
+var (
+	mainModuleOnce sync.Once
+	mainModule     string
+)
+
+// isMainModule reports whether pkg is in the main module of the binary.
+func isMainModule(pkg string) bool {
+	if pkg == "main" {
+		return true
+	}
+	mainModuleOnce.Do(func() {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			mainModule = info.Main.Path
+		}
+	})
+	if mainModule == "" {
+		return false
+	}
+	pkg = strings.TrimSuffix(pkg, "_test")
+	return pkg == mainModule || strings.HasPrefix(pkg, mainModule+"/")
+}
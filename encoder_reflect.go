@@ -0,0 +1,389 @@
+package log
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	objectMarshalerType = reflect.TypeOf((*zapcore.ObjectMarshaler)(nil)).Elem()
+	arrayMarshalerType  = reflect.TypeOf((*zapcore.ArrayMarshaler)(nil)).Elem()
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	errorType           = reflect.TypeOf((*error)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// appendValue writes a reflected value the way the JSON encoder would,
+// respecting json struct tags and the marshaler interfaces, but using the
+// pretty encoder's syntax for objects and arrays. depth is how many
+// reflected structs, maps and slices v is nested in.
+func (enc *prettyEncoder) appendValue(v reflect.Value, depth int) error {
+	if !v.IsValid() {
+		enc.appendNull()
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			enc.appendNull()
+			return nil
+		}
+	}
+
+	if v.CanInterface() {
+		switch t := v.Type(); {
+		case t == timeType:
+			enc.AppendTime(v.Interface().(time.Time))
+			return nil
+		case t == durationType:
+			enc.AppendDuration(v.Interface().(time.Duration))
+			return nil
+		case t.Implements(objectMarshalerType):
+			return enc.AppendObject(v.Interface().(zapcore.ObjectMarshaler))
+		case t.Implements(arrayMarshalerType):
+			return enc.AppendArray(v.Interface().(zapcore.ArrayMarshaler))
+		case t.Implements(jsonMarshalerType):
+			b, err := v.Interface().(json.Marshaler).MarshalJSON()
+			if err != nil {
+				return err
+			}
+			enc.addElementSeparator()
+			enc.buf.Write(b)
+			return nil
+		case t.Implements(textMarshalerType):
+			b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return err
+			}
+			enc.AppendString(string(b))
+			return nil
+		case t.Implements(errorType):
+			enc.AppendString(v.Interface().(error).Error())
+			return nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice:
+		// The depth limit may be disabled, so values which refer to
+		// themselves are caught here instead.
+		if !enc.visit(v) {
+			enc.addElementSeparator()
+			enc.buf.AppendString("<cycle>")
+			return nil
+		}
+		defer enc.leave(v)
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		enc.AppendBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		enc.AppendInt64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		enc.AppendUint64(v.Uint())
+	case reflect.Float32:
+		enc.AppendFloat32(float32(v.Float()))
+	case reflect.Float64:
+		enc.AppendFloat64(v.Float())
+	case reflect.Complex64:
+		enc.AppendComplex64(complex64(v.Complex()))
+	case reflect.Complex128:
+		enc.AppendComplex128(v.Complex())
+	case reflect.String:
+		enc.AppendString(v.String())
+	case reflect.Ptr, reflect.Interface:
+		return enc.appendValue(v.Elem(), depth)
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Slice {
+			enc.AppendBinary(v.Bytes())
+			return nil
+		}
+		return enc.appendList(v, depth)
+	case reflect.Map:
+		return enc.appendMap(v, depth)
+	case reflect.Struct:
+		return enc.appendStruct(v, depth)
+	default:
+		// Channels, functions and unsafe pointers have no sensible
+		// representation, so just say what they are.
+		enc.addElementSeparator()
+		enc.buf.AppendByte('<')
+		enc.buf.AppendString(v.Type().String())
+		enc.buf.AppendByte('>')
+	}
+	return nil
+}
+
+// visitKey identifies a pointer, map or slice being written. The length and
+// type tell apart slices of the same array, and a struct from its first
+// field.
+type visitKey struct {
+	ptr uintptr
+	len int
+	typ reflect.Type
+}
+
+func newVisitKey(v reflect.Value) visitKey {
+	k := visitKey{ptr: v.Pointer(), typ: v.Type()}
+	if v.Kind() == reflect.Slice {
+		k.len = v.Len()
+	}
+	return k
+}
+
+// visit records that v is being written, returning false if it already is,
+// because it refers to itself.
+func (enc *prettyEncoder) visit(v reflect.Value) bool {
+	k := newVisitKey(v)
+	if enc.visiting[k] {
+		return false
+	}
+	if enc.visiting == nil {
+		enc.visiting = make(map[visitKey]bool)
+	}
+	enc.visiting[k] = true
+	return true
+}
+
+// leave records that v has been written.
+func (enc *prettyEncoder) leave(v reflect.Value) {
+	delete(enc.visiting, newVisitKey(v))
+}
+
+func (enc *prettyEncoder) appendNull() {
+	enc.addElementSeparator()
+	enc.buf.AppendString("null")
+}
+
+// open starts writing an object or array, returning false if it's nested too
+// deeply to write, in which case it's written as elided.
+func (enc *prettyEncoder) open(start, end byte, depth int) bool {
+	enc.addElementSeparator()
+	enc.buf.AppendByte(start)
+	if max := enc.opts.maxDepth; max > 0 && depth >= max {
+		enc.buf.AppendString("...")
+		enc.buf.AppendByte(end)
+		return false
+	}
+	enc.depth++
+	return true
+}
+
+func (enc *prettyEncoder) close(end byte) {
+	enc.depth--
+	enc.buf.AppendByte(end)
+}
+
+// elided writes how many elements of a map or slice weren't written.
+func (enc *prettyEncoder) elided(n int) {
+	enc.addElementSeparator()
+	enc.buf.AppendString("... ")
+	enc.buf.AppendInt(int64(n))
+	enc.buf.AppendString(" more")
+}
+
+func (enc *prettyEncoder) appendList(v reflect.Value, depth int) error {
+	if !enc.open('[', ']', depth) {
+		return nil
+	}
+	defer enc.close(']')
+
+	n := v.Len()
+	if max := enc.opts.maxLength; max > 0 && n > max {
+		defer enc.elided(n - max)
+		n = max
+	}
+	for i := 0; i < n; i++ {
+		if err := enc.appendValue(v.Index(i), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (enc *prettyEncoder) appendMap(v reflect.Value, depth int) error {
+	if !enc.open('{', '}', depth) {
+		return nil
+	}
+	defer enc.close('}')
+	defer enc.resetNamespace()()
+
+	type entry struct {
+		key   string
+		value reflect.Value
+	}
+	entries := make([]entry, 0, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		key, err := mapKey(iter.Key())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{key: key, value: iter.Value()})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+
+	if max := enc.opts.maxLength; max > 0 && len(entries) > max {
+		defer enc.elided(len(entries) - max)
+		entries = entries[:max]
+	}
+	for _, e := range entries {
+		enc.addKey(e.key)
+		if err := enc.appendValue(e.value, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mapKey returns the key of a map entry as the JSON encoder would.
+func mapKey(k reflect.Value) (string, error) {
+	if k.Kind() == reflect.String {
+		return k.String(), nil
+	}
+	if k.Type().Implements(textMarshalerType) && k.CanInterface() {
+		tm := k.Interface().(encoding.TextMarshaler)
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return "", nil
+		}
+		b, err := tm.MarshalText()
+		return string(b), err
+	}
+	switch k.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", &json.UnsupportedTypeError{Type: k.Type()}
+}
+
+func (enc *prettyEncoder) appendStruct(v reflect.Value, depth int) error {
+	if !enc.open('{', '}', depth) {
+		return nil
+	}
+	defer enc.close('}')
+	defer enc.resetNamespace()()
+
+	for _, f := range cachedFields(v.Type()) {
+		fv, err := v.FieldByIndexErr(f.index)
+		if err != nil {
+			// The field is in an embedded struct through a nil pointer.
+			continue
+		}
+		if f.omitEmpty && isEmptyValue(fv) {
+			continue
+		}
+		enc.addKey(f.name)
+		if err := enc.appendValue(fv, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetNamespace clears the namespace while writing an object, returning a
+// function to restore it.
+func (enc *prettyEncoder) resetNamespace() func() {
+	namespace := enc.namespace
+	enc.namespace = ""
+	return func() { enc.namespace = namespace }
+}
+
+// structField is an exported field of a struct, named as the JSON encoder
+// would name it.
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]structField
+
+func cachedFields(t reflect.Type) []structField {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields, _ := fieldCache.LoadOrStore(t, typeFields(t, nil, map[reflect.Type]bool{t: true}))
+	return fields.([]structField)
+}
+
+// typeFields returns the fields of t which the JSON encoder would write,
+// including those promoted from untagged embedded structs. Unlike the JSON
+// encoder, it doesn't resolve conflicts between promoted fields. seen holds
+// the structs already being walked, to stop recursive embedding.
+func typeFields(t reflect.Type, index []int, seen map[reflect.Type]bool) []structField {
+	var fields []structField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		idx := append(append([]int(nil), index...), i)
+
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				if !sf.IsExported() {
+					// Like the JSON encoder, ignore pointers to
+					// unexported structs, which can't be set.
+					continue
+				}
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if !seen[ft] {
+					seen[ft] = true
+					fields = append(fields, typeFields(ft, idx, seen)...)
+					delete(seen, ft)
+				}
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, structField{
+			name:      name,
+			index:     idx,
+			omitEmpty: strings.Contains(","+opts+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+// isEmptyValue reports whether v is empty, as defined by the omitempty json
+// tag option.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
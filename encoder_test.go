@@ -0,0 +1,191 @@
+package log
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+type goldenStringer string
+
+func (s goldenStringer) String() string { return string(s) }
+
+type goldenStruct struct {
+	Name  string            `json:"name"`
+	Tags  []string          `json:"tags,omitempty"`
+	Attrs map[string]string `json:"attrs"`
+	Skip  string            `json:"-"`
+}
+
+// goldenFields returns a field made with each of the constructors exported
+// by logger.go, named after it. Some constructors have more than one case.
+func goldenFields() []struct {
+	name   string
+	fields []Field
+} {
+	t := time.Date(2022, 8, 1, 12, 30, 45, 500000000, time.UTC)
+	d := 1500 * time.Millisecond
+	s, b, i, u := "text", true, 42, uint(42)
+	f32, f64 := float32(1.5), 2.25
+	c64, c128 := complex64(1+2i), complex(3, -4)
+
+	// Stack is taken in a goroutine of its own, so the only frame is in
+	// this file.
+	stack := make(chan Field)
+	go func() { stack <- Stack("k") }()
+
+	obj := zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		enc.AddString("name", "obj")
+		enc.AddInt("count", 2)
+		return nil
+	})
+	arr := zapcore.ArrayMarshalerFunc(func(enc zapcore.ArrayEncoder) error {
+		enc.AppendString("a")
+		enc.AppendInt(1)
+		return enc.AppendObject(obj)
+	})
+
+	return []struct {
+		name   string
+		fields []Field
+	}{
+		{"Any", []Field{Any("k", map[string]interface{}{"b": 1, "a": []string{"x", "y"}})}},
+		{"Any struct", []Field{Any("k", goldenStruct{Name: "n", Attrs: map[string]string{"a": "1"}, Skip: "s"})}},
+		{"Array", []Field{Array("k", arr)}},
+		{"Binary", []Field{Binary("k", []byte{0xde, 0xad, 0xbe, 0xef})}},
+		{"Bool", []Field{Bool("k", true)}},
+		{"Boolp", []Field{Boolp("k", &b)}},
+		{"Boolp nil", []Field{Boolp("k", nil)}},
+		{"Bools", []Field{Bools("k", []bool{true, false})}},
+		{"ByteString", []Field{ByteString("k", []byte("bytes"))}},
+		{"ByteStrings", []Field{ByteStrings("k", [][]byte{[]byte("a"), []byte("b")})}},
+		{"Complex128", []Field{Complex128("k", c128)}},
+		{"Complex128p", []Field{Complex128p("k", &c128)}},
+		{"Complex128s", []Field{Complex128s("k", []complex128{1 + 2i, 3 - 4i})}},
+		{"Complex64", []Field{Complex64("k", c64)}},
+		{"Complex64p", []Field{Complex64p("k", &c64)}},
+		{"Complex64s", []Field{Complex64s("k", []complex64{1 + 2i, 3 - 4i})}},
+		{"Duration", []Field{Duration("k", d)}},
+		{"Durationp", []Field{Durationp("k", &d)}},
+		{"Durations", []Field{Durations("k", []time.Duration{time.Second, 2 * time.Second, 3 * time.Second})}},
+		{"Error", []Field{Error(errors.New("boom"))}},
+		{"Error multi-line", []Field{Error(errors.New("first line\nsecond line"))}},
+		{"Errors", []Field{Errors("k", []error{errors.New("a"), errors.New("b")})}},
+		{"Float32", []Field{Float32("k", f32)}},
+		{"Float32p", []Field{Float32p("k", &f32)}},
+		{"Float32s", []Field{Float32s("k", []float32{1.5, 2})}},
+		{"Float64", []Field{Float64("k", f64)}},
+		{"Float64p", []Field{Float64p("k", &f64)}},
+		{"Float64s", []Field{Float64s("k", []float64{0.1, 1e21})}},
+		{"Inline", []Field{Inline(obj)}},
+		{"Int", []Field{Int("k", i)}},
+		{"Int16", []Field{Int16("k", -16)}},
+		{"Int16p", []Field{Int16p("k", func() *int16 { v := int16(-16); return &v }())}},
+		{"Int16s", []Field{Int16s("k", []int16{1, -2})}},
+		{"Int32", []Field{Int32("k", -32)}},
+		{"Int32p", []Field{Int32p("k", func() *int32 { v := int32(-32); return &v }())}},
+		{"Int32s", []Field{Int32s("k", []int32{1, -2})}},
+		{"Int64", []Field{Int64("k", -64)}},
+		{"Int64p", []Field{Int64p("k", func() *int64 { v := int64(-64); return &v }())}},
+		{"Int64s", []Field{Int64s("k", []int64{1, -2})}},
+		{"Int8", []Field{Int8("k", -8)}},
+		{"Int8p", []Field{Int8p("k", func() *int8 { v := int8(-8); return &v }())}},
+		{"Int8s", []Field{Int8s("k", []int8{1, -2})}},
+		{"Intp", []Field{Intp("k", &i)}},
+		{"Ints", []Field{Ints("k", []int{1, 2, 3})}},
+		{"NamedError", []Field{NamedError("k", errors.New("boom"))}},
+		{"Namespace", []Field{Namespace("ns"), String("k", "v")}},
+		{"Object", []Field{Object("k", obj)}},
+		{"Reflect", []Field{Reflect("k", []goldenStruct{{Name: "n", Tags: []string{"t"}}})}},
+		{"Skip", []Field{Skip()}},
+		{"Stack", []Field{<-stack}},
+		{"StackSkip", []Field{StackSkip("k", 100)}},
+		{"String", []Field{String("k", "quoted \"text\"\ttab")}},
+		{"Stringer", []Field{Stringer("k", goldenStringer("stringer"))}},
+		{"Stringers", []Field{Stringers("k", []goldenStringer{"a", "b"})}},
+		{"Stringp", []Field{Stringp("k", &s)}},
+		{"Strings", []Field{Strings("k", []string{"a", "b"})}},
+		{"Time", []Field{Time("k", t)}},
+		{"Timep", []Field{Timep("k", &t)}},
+		{"Times", []Field{Times("k", []time.Time{t, t.Add(time.Hour)})}},
+		{"Uint", []Field{Uint("k", u)}},
+		{"Uint16", []Field{Uint16("k", 16)}},
+		{"Uint16p", []Field{Uint16p("k", func() *uint16 { v := uint16(16); return &v }())}},
+		{"Uint16s", []Field{Uint16s("k", []uint16{1, 2})}},
+		{"Uint32", []Field{Uint32("k", 32)}},
+		{"Uint32p", []Field{Uint32p("k", func() *uint32 { v := uint32(32); return &v }())}},
+		{"Uint32s", []Field{Uint32s("k", []uint32{1, 2})}},
+		{"Uint64", []Field{Uint64("k", 64)}},
+		{"Uint64p", []Field{Uint64p("k", func() *uint64 { v := uint64(64); return &v }())}},
+		{"Uint64s", []Field{Uint64s("k", []uint64{1, 2})}},
+		{"Uint8", []Field{Uint8("k", 8)}},
+		{"Uint8p", []Field{Uint8p("k", func() *uint8 { v := uint8(8); return &v }())}},
+		{"Uint8s", []Field{Uint8s("k", []uint8{1, 2})}},
+		{"Uintp", []Field{Uintp("k", &u)}},
+		{"Uintptr", []Field{Uintptr("k", 0xff)}},
+		{"Uintptrp", []Field{Uintptrp("k", func() *uintptr { v := uintptr(0xff); return &v }())}},
+		{"Uintptrs", []Field{Uintptrs("k", []uintptr{1, 2})}},
+		{"Uints", []Field{Uints("k", []uint{1, 2})}},
+	}
+}
+
+func TestEncoderGolden(t *testing.T) {
+	// Only the message and fields are written, since the rest of an entry
+	// is covered elsewhere, and the time would change on every run.
+	jsonConfig := defaultEncoderConfig
+	jsonConfig.TimeKey = zapcore.OmitKey
+	jsonConfig.LevelKey = zapcore.OmitKey
+	prettyConfig := newPrettyEncoderConfig()
+	prettyConfig.TimeKey = zapcore.OmitKey
+	prettyConfig.LevelKey = zapcore.OmitKey
+
+	tests := []struct {
+		name string
+		enc  zapcore.Encoder
+	}{
+		{"json", zapcore.NewJSONEncoder(jsonConfig)},
+		{"pretty", NewPrettyEncoder(prettyConfig, PrettyColor(false))},
+	}
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got bytes.Buffer
+			for _, f := range goldenFields() {
+				buf, err := tt.enc.EncodeEntry(zapcore.Entry{Message: f.name}, f.fields)
+				if err != nil {
+					t.Fatalf("%s: %v", f.name, err)
+				}
+				got.Write(buf.Bytes())
+				buf.Free()
+			}
+			// Stacks include the path of this file.
+			out := strings.ReplaceAll(got.String(), dir+string(filepath.Separator), "")
+
+			path := filepath.Join("testdata", "fields."+tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out != string(want) {
+				t.Errorf("output doesn't match %s, run go test -update to see the difference:\n%s", path, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package log
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// defaultJournalSocket is where journald listens for its native protocol.
+const defaultJournalSocket = "/run/systemd/journal/socket"
+
+// JournalConfig configures sending logs to systemd-journald.
+type JournalConfig struct {
+	// Socket is the path of journald's socket. Defaults to
+	// /run/systemd/journal/socket.
+	Socket string
+	// Identifier is the SYSLOG_IDENTIFIER of entries from loggers without
+	// a name. Defaults to the name of the executable.
+	Identifier string
+}
+
+// NewJournalCore creates a zapcore.Core which sends entries enabled by enab
+// to journald using its native protocol, so each field is a journal field
+// that can be filtered on. Field names are upper-cased, with nested fields
+// joined by underscores, so a field "http.status" becomes HTTP_STATUS. The
+// level, caller and logger name are written as PRIORITY, CODE_FILE,
+// CODE_LINE, CODE_FUNC and SYSLOG_IDENTIFIER, and fields which would have
+// the same name as those, or MESSAGE or STACKTRACE, are prefixed with F_,
+// such as F_MESSAGE.
+//
+// The connection is made when the first entry is written. The returned
+// function closes it.
+func NewJournalCore(cfg JournalConfig, enab zapcore.LevelEnabler) (zapcore.Core, func() error) {
+	if cfg.Socket == "" {
+		cfg.Socket = defaultJournalSocket
+	}
+	if cfg.Identifier == "" {
+		cfg.Identifier = filepath.Base(os.Args[0])
+	}
+	w := &journalWriter{addr: &net.UnixAddr{Name: cfg.Socket, Net: "unixgram"}}
+	c := &journalCore{
+		LevelEnabler: enab,
+		cfg:          &cfg,
+		w:            w,
+	}
+	return c, w.Close
+}
+
+// journalCore formats entries as journald native protocol messages.
+type journalCore struct {
+	zapcore.LevelEnabler
+	cfg    *JournalConfig
+	w      *journalWriter
+	fields []Field
+}
+
+func (c *journalCore) With(fields []Field) zapcore.Core {
+	clone := *c
+	clone.fields = append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	return &clone
+}
+
+func (c *journalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *journalCore) Write(ent zapcore.Entry, fields []Field) error {
+	buf := bufferpool.Get()
+	defer buf.Free()
+
+	addJournalField(buf, "MESSAGE", ent.Message)
+	addJournalField(buf, "PRIORITY", strconv.Itoa(syslogSeverity(ent.Level)))
+	identifier := ent.LoggerName
+	if identifier == "" {
+		identifier = c.cfg.Identifier
+	}
+	addJournalField(buf, "SYSLOG_IDENTIFIER", identifier)
+	if ent.Caller.Defined {
+		addJournalField(buf, "CODE_FILE", ent.Caller.File)
+		addJournalField(buf, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if ent.Caller.Function != "" {
+			addJournalField(buf, "CODE_FUNC", ent.Caller.Function)
+		}
+	}
+	if ent.Stack != "" {
+		addJournalField(buf, "STACKTRACE", ent.Stack)
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	addFields(enc, c.fields)
+	addFields(enc, fields)
+	params := make(map[string]string, len(enc.Fields))
+	flattenFields(params, "", enc.Fields)
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		addJournalField(buf, journalFieldName(name), params[name])
+	}
+
+	return c.w.write(buf.Bytes())
+}
+
+func (c *journalCore) Sync() error {
+	return nil
+}
+
+// addJournalField writes a field in the native protocol, which is KEY=value
+// on a line of its own, or for values with newlines, the key on its own
+// line followed by the length of the value, as a little endian uint64, and
+// then the value.
+func addJournalField(buf *buffer.Buffer, name, value string) {
+	buf.AppendString(name)
+	if strings.IndexByte(value, '\n') < 0 {
+		buf.AppendByte('=')
+		buf.AppendString(value)
+		buf.AppendByte('\n')
+		return
+	}
+	buf.AppendByte('\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	buf.Write(size[:])
+	buf.AppendString(value)
+	buf.AppendByte('\n')
+}
+
+// journalCoreFields are the journal fields the core writes for every
+// entry, which fields of the same name are prefixed to stay apart from.
+var journalCoreFields = map[string]bool{
+	"MESSAGE":           true,
+	"PRIORITY":          true,
+	"SYSLOG_IDENTIFIER": true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"STACKTRACE":        true,
+}
+
+// journalFieldName converts the name of a field to a journal field name,
+// which can only contain upper case letters, digits and underscores, can't
+// start with an underscore or digit, and is at most 64 characters. Names
+// which would be the same as one of the core's own fields, such as MESSAGE,
+// are prefixed with F_.
+func journalFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+	// Names starting with an underscore are reserved for fields added by
+	// journald itself.
+	name = strings.TrimLeft(name, "_")
+	if name == "" || name[0] >= '0' && name[0] <= '9' || journalCoreFields[name] {
+		name = "F_" + name
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+var errJournalClosed = errors.New("journal connection is closed")
+
+// journalWriter sends datagrams to journald, opening a socket when needed.
+// The socket isn't connected, as descriptors for large entries can only be
+// passed with an address.
+type journalWriter struct {
+	addr *net.UnixAddr
+
+	mu     sync.Mutex
+	conn   *net.UnixConn
+	closed bool
+}
+
+func (w *journalWriter) write(msg []byte) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errJournalClosed
+	}
+	if w.conn == nil {
+		conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Net: "unixgram"})
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	_, _, err := w.conn.WriteMsgUnix(msg, nil, w.addr)
+	if isMessageTooLarge(err) {
+		// Entries too large for a datagram are written to a file which
+		// is passed to journald instead.
+		return sendJournalFile(w.conn, w.addr, msg)
+	}
+	return err
+}
+
+// Close closes the connection to journald.
+func (w *journalWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
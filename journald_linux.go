@@ -0,0 +1,32 @@
+package log
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+)
+
+// isMessageTooLarge reports whether err is from a datagram which was too
+// large to send.
+func isMessageTooLarge(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE) || errors.Is(err, syscall.ENOBUFS)
+}
+
+// sendJournalFile writes msg to an unlinked file in /dev/shm, and passes its
+// descriptor to journald, which reads the entry from it.
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, msg []byte) error {
+	f, err := os.CreateTemp("/dev/shm", "journal.*")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	if _, err := f.Write(msg); err != nil {
+		return err
+	}
+	_, _, err = conn.WriteMsgUnix(nil, syscall.UnixRights(int(f.Fd())), addr)
+	return err
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestJournalCoreLargeEntry(t *testing.T) {
+	conn, path := listenJournal(t)
+	core, close := NewJournalCore(JournalConfig{Socket: path, Identifier: "app"}, DebugLevel)
+	defer close()
+
+	// This is larger than the default maximum size of a datagram, so the
+	// entry is passed as a file instead.
+	big := strings.Repeat("x", 1<<20)
+	if err := core.Write(zapcore.Entry{Level: InfoLevel, Message: big}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	oob := make([]byte, syscall.CmsgSpace(4))
+	n, oobn, _, _, err := conn.ReadMsgUnix(nil, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("got a %d byte datagram, want the entry passed as a file", n)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("got control messages %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("got descriptors %v, %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "entry")
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MESSAGE=" + big + "\nPRIORITY=6\nSYSLOG_IDENTIFIER=app\n"
+	if string(b) != want {
+		t.Errorf("got a %d byte entry, want %d bytes", len(b), len(want))
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package log
+
+import (
+	"errors"
+	"net"
+)
+
+// isMessageTooLarge returns false, since journald only runs on Linux.
+func isMessageTooLarge(err error) bool {
+	return false
+}
+
+// sendJournalFile is never called, since journald only runs on Linux.
+func sendJournalFile(conn *net.UnixConn, addr *net.UnixAddr, msg []byte) error {
+	return errors.New("journald is only supported on linux")
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+
+package log
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// listenJournal listens on a unixgram socket in place of journald.
+func listenJournal(t *testing.T) (*net.UnixConn, string) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return conn, path
+}
+
+func TestJournalCore(t *testing.T) {
+	conn, path := listenJournal(t)
+	core, close := NewJournalCore(JournalConfig{Socket: path, Identifier: "app"}, DebugLevel)
+	defer close()
+
+	ent := zapcore.Entry{
+		Level:   WarnLevel,
+		Message: "slow query",
+		Caller:  zapcore.NewEntryCaller(0, "/src/db/query.go", 42, true),
+	}
+	core = core.With([]Field{Namespace("query")})
+	if err := core.Write(ent, []Field{
+		Int("rows", 3),
+		Any("args", map[string]int{"id": 1}),
+		Error(errors.New("first line\nsecond line")),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	b := make([]byte, 64<<10)
+	n, err := conn.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "MESSAGE=slow query\n" +
+		"PRIORITY=4\n" +
+		"SYSLOG_IDENTIFIER=app\n" +
+		"CODE_FILE=/src/db/query.go\n" +
+		"CODE_LINE=42\n" +
+		"QUERY_ARGS_ID=1\n" +
+		"QUERY_ERROR\n\x16\x00\x00\x00\x00\x00\x00\x00first line\nsecond line\n" +
+		"QUERY_ROWS=3\n"
+	if got := string(b[:n]); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestJournalFieldName(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{"status", "STATUS"},
+		{"http.status_code", "HTTP_STATUS_CODE"},
+		{"_private", "PRIVATE"},
+		{"2fa", "F_2FA"},
+		{"", "F_"},
+		{"héllo", "H_LLO"},
+		{"message", "F_MESSAGE"},
+		{"code.line", "F_CODE_LINE"},
+		{"_priority", "F_PRIORITY"},
+		{"message_id", "MESSAGE_ID"},
+	}
+	for _, tt := range tests {
+		if got := journalFieldName(tt.name); got != tt.want {
+			t.Errorf("journalFieldName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Layout controls how the pretty encoder lays out each entry.
+type Layout string
+
+const (
+	// LayoutCompact writes each part of an entry straight after the last.
+	LayoutCompact Layout = "compact"
+	// LayoutAligned pads the message, and puts the logger name and caller
+	// into fixed width columns, so fields line up from one line to the
+	// next. When writing to a terminal, fields which don't fit on a line
+	// wrap onto indented continuation lines.
+	LayoutAligned Layout = "aligned"
+)
+
+const (
+	// defaultMessageWidth is the width messages are padded to with
+	// LayoutAligned, unless configured otherwise.
+	defaultMessageWidth = 40
+	// nameColumnWidth and callerColumnWidth are the widths of the logger
+	// name and caller columns with LayoutAligned.
+	nameColumnWidth   = 16
+	callerColumnWidth = 24
+)
+
+// ParseLayout parses a Layout. An empty string is LayoutCompact.
+func ParseLayout(text string) (Layout, error) {
+	switch layout := Layout(strings.ToLower(strings.TrimSpace(text))); layout {
+	case "":
+		return LayoutCompact, nil
+	case LayoutCompact, LayoutAligned:
+		return layout, nil
+	default:
+		return "", fmt.Errorf("unrecognized layout: %q", text)
+	}
+}
+
+// DetectLayout returns the Layout based on the PS_LOG_LAYOUT env var, which
+// is one of compact or aligned. Defaults to compact.
+func DetectLayout() Layout {
+	layout, err := ParseLayout(os.Getenv("PS_LOG_LAYOUT"))
+	if err != nil {
+		panic("Invalid PS_LOG_LAYOUT value: " + os.Getenv("PS_LOG_LAYOUT"))
+	}
+	return layout
+}
+
+// terminalWidth returns the width of the terminal f, or zero if it isn't
+// known. The COLUMNS env var takes precedence, as it does for most tools.
+func terminalWidth(f *os.File) int {
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		return n
+	}
+	return ttyWidth(f)
+}
+
+// addColumn writes a column of at least width columns, with write.
+func (enc *prettyEncoder) addColumn(width int, style Style, write func()) {
+	enc.buf.AppendByte(' ')
+	start := enc.buf.Len()
+	styled := enc.startStyle(style)
+	enc.unquoted = true
+	write()
+	enc.unquoted = false
+	enc.endStyle(styled)
+	enc.pad(start, width)
+}
+
+// pad pads what's been written since start with spaces, until it's at least
+// width columns wide.
+func (enc *prettyEncoder) pad(start, width int) {
+	for n := visibleWidth(enc.buf.Bytes()[start:]); n < width; n++ {
+		enc.buf.AppendByte(' ')
+	}
+}
+
+// wrapFields rewrites the top level fields so none extends past the wrap
+// width, by moving those which would onto a new line, indented by indent
+// columns. A field which is too wide on its own is left to overflow.
+func (enc *prettyEncoder) wrapFields(indent int) {
+	if enc.opts.wrap <= 0 || len(enc.fieldStarts) == 0 {
+		return
+	}
+	b := enc.buf.Bytes()
+	head := b[:enc.fieldStarts[0]]
+	col := visibleWidth(head[strings.LastIndex(string(head), "\n")+1:])
+	fields := append([]byte(nil), b[enc.fieldStarts[0]:]...)
+	enc.buf.Reset()
+	enc.buf.Write(head)
+
+	base := enc.fieldStarts[0]
+	for i, start := range enc.fieldStarts {
+		end := base + len(fields)
+		if i+1 < len(enc.fieldStarts) {
+			end = enc.fieldStarts[i+1]
+		}
+		field := fields[start-base : end-base]
+		n := visibleWidth(field)
+		if col+n > enc.opts.wrap && col > indent && len(field) > 0 && field[0] == ' ' {
+			enc.buf.AppendString(enc.LineEnding)
+			enc.buf.AppendString(strings.Repeat(" ", indent))
+			field = field[1:]
+			col, n = indent, n-1
+		}
+		enc.buf.Write(field)
+		col += n
+	}
+}
+
+// trimTrailingSpaces removes any padding left at the end of the buffer.
+func (enc *prettyEncoder) trimTrailingSpaces() {
+	b := enc.buf.Bytes()
+	n := len(b)
+	for n > 0 && b[n-1] == ' ' {
+		n--
+	}
+	if n < len(b) {
+		enc.buf.Reset()
+		enc.buf.Write(b[:n])
+	}
+}
+
+// visibleWidth returns how many columns b takes up on a terminal, ignoring
+// ANSI escape sequences, and assuming each rune takes up one.
+func visibleWidth(b []byte) int {
+	n := 0
+	for i := 0; i < len(b); i++ {
+		if b[i] == escape[0] {
+			for i < len(b) && b[i] != 'm' {
+				i++
+			}
+			continue
+		}
+		if utf8.RuneStart(b[i]) {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,231 @@
+package log
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelHandler is an http.Handler which reports on, or changes, a Level at
+// runtime. Unlike zap.AtomicLevel's own ServeHTTP, a change can be made
+// temporary with a TTL, after which the previous Level is restored, and
+// every change is logged.
+type LevelHandler struct {
+	level  zap.AtomicLevel
+	logger *Logger
+
+	mu sync.Mutex
+	// revert is the pending revert of a temporary change, if any.
+	revert     *time.Timer
+	revertTo   Level
+	revertTime time.Time
+}
+
+// NewLevelHandler creates a LevelHandler which changes level, and logs
+// changes to logger. This is typically mounted on an admin mux:
+//
+//	mux.Handle("/log/level", log.NewLevelHandler(cfg.Level, logger))
+func NewLevelHandler(level zap.AtomicLevel, logger *Logger) *LevelHandler {
+	return &LevelHandler{
+		level: level,
+		// The caller would always be changeLevel, which isn't useful.
+		logger: logger.WithOptions(zap.WithCaller(false)),
+	}
+}
+
+type levelPayload struct {
+	Level Level `json:"level"`
+	// RevertTo and ExpiresAt are only set while a temporary change is in
+	// effect.
+	RevertTo  *Level     `json:"revert_to,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type levelErrorPayload struct {
+	Error string `json:"error"`
+}
+
+// ServeHTTP implements http.Handler.
+//
+// # GET
+//
+// The GET request returns the current Level, and when a temporary change
+// is in effect, the Level it reverts to and when:
+//
+//	{"level":"debug","revert_to":"info","expires_at":"2022-08-01T12:00:00Z"}
+//
+// # PUT
+//
+// The PUT request changes the Level, optionally for a TTL after which it
+// reverts to the Level from before the change. As with zap.AtomicLevel,
+// form encoded and JSON bodies are supported:
+//
+//	curl -X PUT localhost:8080/log/level -d level=debug -d ttl=10m
+//	curl -X PUT localhost:8080/log/level -H "Content-Type: application/json" -d '{"level":"debug","ttl":"10m"}'
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	enc := json.NewEncoder(w)
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.Method {
+	case http.MethodGet:
+		enc.Encode(h.payload()) //nolint:errcheck
+	case http.MethodPut:
+		level, ttl, err := decodeLevelRequest(r)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			enc.Encode(levelErrorPayload{Error: err.Error()}) //nolint:errcheck
+			return
+		}
+		h.SetLevel(level, ttl, String("remote_addr", r.RemoteAddr))
+		enc.Encode(h.payload()) //nolint:errcheck
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		enc.Encode(levelErrorPayload{Error: "Only GET and PUT are supported."}) //nolint:errcheck
+	}
+}
+
+func (h *LevelHandler) payload() levelPayload {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	p := levelPayload{Level: h.level.Level()}
+	if h.revert != nil {
+		revertTo, revertTime := h.revertTo, h.revertTime
+		p.RevertTo, p.ExpiresAt = &revertTo, &revertTime
+	}
+	return p
+}
+
+// SetLevel changes the Level. If ttl is positive, the change is reverted
+// after ttl. Any pending revert is replaced, but a temporary change always
+// reverts to the Level from before the first temporary change, rather than
+// another temporary Level. fields are added to the audit log line.
+func (h *LevelHandler) SetLevel(level Level, ttl time.Duration, fields ...Field) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	from := h.level.Level()
+	revertTo := from
+	if h.revert != nil {
+		h.revert.Stop()
+		h.revert = nil
+		revertTo = h.revertTo
+	}
+
+	fields = append(fields, Stringer("from", from), Stringer("to", level))
+	if ttl > 0 {
+		h.revertTo = revertTo
+		h.revertTime = time.Now().Add(ttl)
+		fields = append(fields, Duration("ttl", ttl))
+
+		var timer *time.Timer
+		timer = time.AfterFunc(ttl, func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			// The timer may have fired just as it was replaced.
+			if h.revert != timer {
+				return
+			}
+			h.revert = nil
+			h.changeLevel("log level change expired", h.revertTo,
+				Stringer("from", h.level.Level()), Stringer("to", h.revertTo))
+		})
+		h.revert = timer
+	}
+	h.changeLevel("log level changed", level, fields...)
+}
+
+// changeLevel sets the Level and logs msg, with h.mu held. The line is
+// logged at the more verbose of the two Levels, between WarnLevel and
+// ErrorLevel, while that Level is in effect, so it isn't filtered out by
+// either of them.
+func (h *LevelHandler) changeLevel(msg string, level Level, fields ...Field) {
+	from := h.level.Level()
+	if level < from {
+		h.level.SetLevel(level)
+	}
+	lvl := from
+	if level < lvl {
+		lvl = level
+	}
+	if lvl < WarnLevel {
+		lvl = WarnLevel
+	}
+	// The levels above ErrorLevel panic or exit.
+	if lvl > ErrorLevel {
+		lvl = ErrorLevel
+	}
+	if ce := h.logger.Check(lvl, msg); ce != nil {
+		ce.Write(fields...)
+	} else {
+		// Both Levels are above ErrorLevel, so the line is written to the
+		// core directly, as the level check would drop it.
+		h.logger.Core().Write(zapcore.Entry{Level: lvl, Time: time.Now(), Message: msg}, fields) //nolint:errcheck
+	}
+	if level >= from {
+		h.level.SetLevel(level)
+	}
+}
+
+func decodeLevelRequest(r *http.Request) (Level, time.Duration, error) {
+	if r.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
+		return decodeLevelForm(r)
+	}
+	return decodeLevelJSON(r.Body)
+}
+
+func decodeLevelForm(r *http.Request) (Level, time.Duration, error) {
+	lvl := r.FormValue("level")
+	if lvl == "" {
+		return 0, 0, errors.New("must specify logging level")
+	}
+	level, err := ParseLevel(lvl)
+	if err != nil {
+		return 0, 0, err
+	}
+	var ttl time.Duration
+	if v := r.FormValue("ttl"); v != "" {
+		if ttl, err = parseTTL(v); err != nil {
+			return 0, 0, err
+		}
+	}
+	return level, ttl, nil
+}
+
+func decodeLevelJSON(body io.Reader) (Level, time.Duration, error) {
+	var pld struct {
+		Level *Level `json:"level"`
+		TTL   string `json:"ttl"`
+	}
+	if err := json.NewDecoder(body).Decode(&pld); err != nil {
+		return 0, 0, fmt.Errorf("malformed request body: %v", err)
+	}
+	if pld.Level == nil {
+		return 0, 0, errors.New("must specify logging level")
+	}
+	var ttl time.Duration
+	if pld.TTL != "" {
+		var err error
+		if ttl, err = parseTTL(pld.TTL); err != nil {
+			return 0, 0, err
+		}
+	}
+	return *pld.Level, ttl, nil
+}
+
+func parseTTL(v string) (time.Duration, error) {
+	ttl, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ttl: %v", err)
+	}
+	if ttl < 0 {
+		return 0, errors.New("ttl must not be negative")
+	}
+	return ttl, nil
+}
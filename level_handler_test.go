@@ -0,0 +1,38 @@
+package log
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLevelHandlerAuditLevel(t *testing.T) {
+	tests := []struct {
+		from, to, want Level
+	}{
+		{InfoLevel, DebugLevel, WarnLevel},
+		{DebugLevel, ErrorLevel, WarnLevel},
+		{ErrorLevel, FatalLevel, ErrorLevel},
+		{FatalLevel, ErrorLevel, ErrorLevel},
+		{DPanicLevel, FatalLevel, ErrorLevel},
+	}
+	for _, tt := range tests {
+		level := zap.NewAtomicLevelAt(tt.from)
+		core, logs := observer.New(level)
+		h := NewLevelHandler(level, zap.New(core))
+		h.SetLevel(tt.to, 0)
+
+		entries := logs.AllUntimed()
+		if len(entries) != 1 {
+			t.Errorf("%v to %v: got %d lines, want 1", tt.from, tt.to, len(entries))
+			continue
+		}
+		if got := entries[0].Level; got != tt.want {
+			t.Errorf("%v to %v: got a line at %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+		if got := level.Level(); got != tt.to {
+			t.Errorf("%v to %v: got level %v", tt.from, tt.to, got)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// NamedLevels holds Level overrides for named loggers, keyed on the name
+// given to Logger.Named. An override applies to the logger with that name,
+// and all of its descendants, so an override for "vtgate" also applies to
+// "vtgate.router". The override for the longest matching name wins.
+//
+// NamedLevels is safe for concurrent use, so overrides can be changed at
+// runtime.
+type NamedLevels struct {
+	mu sync.Mutex
+	// levels holds an immutable map[string]Level, which is replaced on
+	// every change so that lookups don't need to take the lock.
+	levels atomic.Value
+}
+
+// NewNamedLevels creates NamedLevels with the provided overrides.
+func NewNamedLevels(levels map[string]Level) *NamedLevels {
+	n := &NamedLevels{}
+	copied := make(map[string]Level, len(levels))
+	for name, l := range levels {
+		copied[name] = l
+	}
+	n.levels.Store(copied)
+	return n
+}
+
+func (n *NamedLevels) load() map[string]Level {
+	levels, _ := n.levels.Load().(map[string]Level)
+	return levels
+}
+
+// Set sets the Level override for name.
+func (n *NamedLevels) Set(name string, l Level) {
+	n.update(func(levels map[string]Level) {
+		levels[name] = l
+	})
+}
+
+// Delete removes the Level override for name.
+func (n *NamedLevels) Delete(name string) {
+	n.update(func(levels map[string]Level) {
+		delete(levels, name)
+	})
+}
+
+func (n *NamedLevels) update(fn func(map[string]Level)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	current := n.load()
+	levels := make(map[string]Level, len(current)+1)
+	for name, l := range current {
+		levels[name] = l
+	}
+	fn(levels)
+	n.levels.Store(levels)
+}
+
+// Levels returns a copy of all the overrides.
+func (n *NamedLevels) Levels() map[string]Level {
+	current := n.load()
+	levels := make(map[string]Level, len(current))
+	for name, l := range current {
+		levels[name] = l
+	}
+	return levels
+}
+
+// Level returns the Level override for the logger called name, and whether
+// there is one at all.
+func (n *NamedLevels) Level(name string) (Level, bool) {
+	levels := n.load()
+	if len(levels) == 0 {
+		return 0, false
+	}
+	for {
+		if l, ok := levels[name]; ok {
+			return l, true
+		}
+		i := strings.LastIndexByte(name, '.')
+		if i < 0 {
+			return 0, false
+		}
+		name = name[:i]
+	}
+}
+
+// enabled reports whether any override enables l.
+func (n *NamedLevels) enabled(l Level) bool {
+	for _, override := range n.load() {
+		if override.Enabled(l) {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the overrides as they're parsed by ParseLevels, sorted by
+// name, such as "sqlparser=warn,vtgate.router=debug".
+func (n *NamedLevels) String() string {
+	levels := n.load()
+	names := make([]string, 0, len(levels))
+	for name := range levels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+levels[name].String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// ParseLevels parses a comma separated list of a default Level, and Level
+// overrides for named loggers, such as:
+//
+//	info,vtgate.router=debug,sqlparser=warn
+//
+// The default Level is optional, and is InfoLevel if omitted.
+func ParseLevels(text string) (Level, map[string]Level, error) {
+	def := InfoLevel
+	var (
+		levels map[string]Level
+		hasDef bool
+	)
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, lvl, isNamed := strings.Cut(part, "=")
+		if !isNamed {
+			if hasDef {
+				return def, nil, fmt.Errorf("multiple default levels in %q", text)
+			}
+			l, err := ParseLevel(part)
+			if err != nil {
+				return def, nil, err
+			}
+			def, hasDef = l, true
+			continue
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return def, nil, fmt.Errorf("missing logger name in %q", part)
+		}
+		l, err := ParseLevel(strings.TrimSpace(lvl))
+		if err != nil {
+			return def, nil, err
+		}
+		if levels == nil {
+			levels = make(map[string]Level)
+		}
+		levels[name] = l
+	}
+	return def, levels, nil
+}
+
+// DetectNamedLevels returns the Level overrides for named loggers from the
+// PS_LOG_LEVEL env var, such as PS_LOG_LEVEL=info,vtgate.router=debug.
+func DetectNamedLevels() *NamedLevels {
+	_, levels, err := ParseLevels(os.Getenv("PS_LOG_LEVEL"))
+	if err != nil {
+		panic("Invalid PS_LOG_LEVEL value: " + os.Getenv("PS_LOG_LEVEL"))
+	}
+	return NewNamedLevels(levels)
+}
+
+// namedLevelCore is a zapcore.Core which filters entries based on the Level
+// for the name of the logger they're written with.
+type namedLevelCore struct {
+	zapcore.Core
+	level zap.AtomicLevel
+	named *NamedLevels
+}
+
+// newNamedLevelCore wraps the core created by newCore, which is passed the
+// LevelEnabler it must use.
+func newNamedLevelCore(level zap.AtomicLevel, named *NamedLevels, newCore func(zapcore.LevelEnabler) zapcore.Core) zapcore.Core {
+	c := &namedLevelCore{level: level, named: named}
+	// The wrapped core only needs to filter out entries that no Level would
+	// enable, since Check does the rest.
+	c.Core = newCore(zap.LevelEnablerFunc(c.Enabled))
+	return c
+}
+
+func (c *namedLevelCore) Enabled(l Level) bool {
+	return c.level.Enabled(l) || c.named.enabled(l)
+}
+
+func (c *namedLevelCore) With(fields []Field) zapcore.Core {
+	return &namedLevelCore{
+		Core:  c.Core.With(fields),
+		level: c.level,
+		named: c.named,
+	}
+}
+
+func (c *namedLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	l, ok := c.named.Level(ent.LoggerName)
+	if !ok {
+		l = c.level.Level()
+	}
+	if !l.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
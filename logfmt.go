@@ -0,0 +1,488 @@
+package log
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// logfmtEncoder writes entries as space separated key=value pairs. Objects
+// are flattened into dotted keys, such as "http.status=200", and arrays
+// into keys with the index of each element, such as "ids.0=1".
+type logfmtEncoder struct {
+	*zapcore.EncoderConfig
+	buf *buffer.Buffer
+	// namespace is the prefix for keys from any open namespaces and
+	// objects, such as "http." after OpenNamespace("http").
+	namespace string
+}
+
+// NewLogfmtEncoder creates an encoder which writes entries in logfmt, as
+// space separated key=value pairs. Values are quoted when they contain
+// spaces, quotes, equals signs or control characters, and nested objects
+// and arrays are flattened into dotted keys.
+func NewLogfmtEncoder(cfg zapcore.EncoderConfig) zapcore.Encoder {
+	if cfg.LineEnding == "" {
+		cfg.LineEnding = zapcore.DefaultLineEnding
+	}
+	return &logfmtEncoder{
+		EncoderConfig: &cfg,
+		buf:           bufferpool.Get(),
+	}
+}
+
+func init() {
+	zap.RegisterEncoder(LogfmtEncoding, func(cfg zapcore.EncoderConfig) (zapcore.Encoder, error) {
+		return NewLogfmtEncoder(cfg), nil
+	})
+}
+
+func (enc *logfmtEncoder) Clone() zapcore.Encoder {
+	clone := &logfmtEncoder{
+		EncoderConfig: enc.EncoderConfig,
+		buf:           bufferpool.Get(),
+		namespace:     enc.namespace,
+	}
+	clone.buf.Write(enc.buf.Bytes())
+	return clone
+}
+
+func (enc *logfmtEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	final := &logfmtEncoder{
+		EncoderConfig: enc.EncoderConfig,
+		buf:           bufferpool.Get(),
+	}
+
+	if final.TimeKey != zapcore.OmitKey {
+		final.addTime(final.TimeKey, ent.Time)
+	}
+	if final.LevelKey != zapcore.OmitKey {
+		levelEncoder := final.EncodeLevel
+		if levelEncoder == nil {
+			levelEncoder = zapcore.LowercaseLevelEncoder
+		}
+		levelEncoder(ent.Level, final.value(final.LevelKey))
+	}
+	if ent.LoggerName != "" && final.NameKey != zapcore.OmitKey {
+		nameEncoder := final.EncodeName
+		if nameEncoder == nil {
+			nameEncoder = zapcore.FullNameEncoder
+		}
+		nameEncoder(ent.LoggerName, final.value(final.NameKey))
+	}
+	if ent.Caller.Defined {
+		if final.CallerKey != zapcore.OmitKey {
+			callerEncoder := final.EncodeCaller
+			if callerEncoder == nil {
+				callerEncoder = zapcore.ShortCallerEncoder
+			}
+			callerEncoder(ent.Caller, final.value(final.CallerKey))
+		}
+		if final.FunctionKey != zapcore.OmitKey {
+			final.AddString(final.FunctionKey, ent.Caller.Function)
+		}
+	}
+	if final.MessageKey != zapcore.OmitKey {
+		final.AddString(final.MessageKey, ent.Message)
+	}
+
+	// Fields from `With()` calls go first, and new fields go into any
+	// namespaces they opened.
+	if enc.buf.Len() > 0 {
+		if final.buf.Len() > 0 {
+			final.buf.AppendByte(' ')
+		}
+		final.buf.Write(enc.buf.Bytes())
+	}
+	final.namespace = enc.namespace
+	addFields(final, fields)
+	final.namespace = ""
+
+	if ent.Stack != "" && final.StacktraceKey != zapcore.OmitKey {
+		final.AddString(final.StacktraceKey, ent.Stack)
+	}
+	final.buf.AppendString(final.LineEnding)
+	return final.buf, nil
+}
+
+// addKey writes key, which already includes the namespace, followed by the
+// equals sign its value goes after.
+func (enc *logfmtEncoder) addKey(key string) {
+	if enc.buf.Len() > 0 {
+		enc.buf.AppendByte(' ')
+	}
+	if key == "" {
+		key = "_"
+	}
+	// Keys can't be quoted, so anything that would need it is replaced.
+	if needsQuotes(key) {
+		key = strings.Map(func(r rune) rune {
+			if needsQuote(r) {
+				return '_'
+			}
+			return r
+		}, key)
+	}
+	enc.buf.AppendString(key)
+	enc.buf.AppendByte('=')
+}
+
+// value returns an encoder for writing the value of key with one of the
+// zapcore encoder functions, such as EncodeTime.
+func (enc *logfmtEncoder) value(key string) *logfmtArrayEncoder {
+	return &logfmtArrayEncoder{enc: enc, key: key, single: true}
+}
+
+func (enc *logfmtEncoder) appendString(s string) {
+	if !needsQuotes(s) {
+		enc.buf.AppendString(s)
+		return
+	}
+	enc.buf.AppendString(strconv.Quote(s))
+}
+
+// needsQuotes reports whether a value needs to be quoted for it to be parsed
+// as a single value.
+func needsQuotes(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if needsQuote(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func needsQuote(r rune) bool {
+	return r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || !unicode.IsPrint(r)
+}
+
+func (enc *logfmtEncoder) appendComplex(c complex128, bitSize int) {
+	enc.buf.AppendFloat(real(c), bitSize)
+	if i := imag(c); i >= 0 {
+		enc.buf.AppendByte('+')
+	}
+	enc.buf.AppendFloat(imag(c), bitSize)
+	enc.buf.AppendByte('i')
+}
+
+// addReflected flattens value as the JSON encoder would write it.
+func (enc *logfmtEncoder) addReflected(key string, value interface{}) error {
+	v, err := reflectedJSON(value)
+	if err != nil {
+		return err
+	}
+	enc.addJSON(key, v)
+	return nil
+}
+
+// reflectedJSON round trips value through JSON, so it can be flattened as
+// the JSON encoder would write it. Numbers are decoded as json.Number, so
+// they're written exactly.
+func reflectedJSON(value interface{}) (interface{}, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (enc *logfmtEncoder) addJSON(key string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			enc.addKey(key)
+			enc.buf.AppendString("{}")
+			return
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			enc.addJSON(key+"."+k, v[k])
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			enc.addKey(key)
+			enc.buf.AppendString("[]")
+			return
+		}
+		for i, e := range v {
+			enc.addJSON(key+"."+strconv.Itoa(i), e)
+		}
+	case string:
+		enc.addKey(key)
+		enc.appendString(v)
+	case json.Number:
+		enc.addKey(key)
+		enc.buf.AppendString(v.String())
+	case bool:
+		enc.addKey(key)
+		enc.buf.AppendBool(v)
+	default:
+		enc.addKey(key)
+		enc.buf.AppendString("null")
+	}
+}
+
+func (enc *logfmtEncoder) AddArray(key string, arr zapcore.ArrayMarshaler) error {
+	a := &logfmtArrayEncoder{enc: enc, key: enc.namespace + key}
+	err := arr.MarshalLogArray(a)
+	if a.n == 0 {
+		enc.addKey(a.key)
+		enc.buf.AppendString("[]")
+	}
+	return err
+}
+
+func (enc *logfmtEncoder) AddObject(key string, obj zapcore.ObjectMarshaler) error {
+	namespace := enc.namespace
+	enc.namespace += key + "."
+	err := obj.MarshalLogObject(enc)
+	enc.namespace = namespace
+	return err
+}
+
+// resetNamespace clears the namespace while writing fields at the top
+// level, returning a function to restore it.
+func (enc *logfmtEncoder) resetNamespace() func() {
+	namespace := enc.namespace
+	enc.namespace = ""
+	return func() { enc.namespace = namespace }
+}
+
+func (enc *logfmtEncoder) AddBinary(key string, value []byte) {
+	enc.AddString(key, base64.StdEncoding.EncodeToString(value))
+}
+
+func (enc *logfmtEncoder) AddByteString(key string, value []byte) {
+	enc.AddString(key, string(value))
+}
+
+func (enc *logfmtEncoder) AddBool(key string, value bool) {
+	enc.addKey(enc.namespace + key)
+	enc.buf.AppendBool(value)
+}
+
+func (enc *logfmtEncoder) AddComplex128(key string, value complex128) {
+	enc.addKey(enc.namespace + key)
+	enc.appendComplex(value, 64)
+}
+
+func (enc *logfmtEncoder) AddComplex64(key string, value complex64) {
+	enc.addKey(enc.namespace + key)
+	enc.appendComplex(complex128(value), 32)
+}
+
+func (enc *logfmtEncoder) AddDuration(key string, value time.Duration) {
+	enc.addDuration(enc.namespace+key, value)
+}
+
+// addDuration writes a duration with EncodeDuration, falling back to Go's
+// formatting if there's no encoder, or it was a no-op.
+func (enc *logfmtEncoder) addDuration(key string, value time.Duration) {
+	a := enc.value(key)
+	if enc.EncodeDuration != nil {
+		enc.EncodeDuration(value, a)
+	}
+	if a.n == 0 {
+		a.AppendString(value.String())
+	}
+}
+
+func (enc *logfmtEncoder) AddFloat64(key string, value float64) {
+	enc.addKey(enc.namespace + key)
+	enc.buf.AppendFloat(value, 64)
+}
+
+func (enc *logfmtEncoder) AddFloat32(key string, value float32) {
+	enc.addKey(enc.namespace + key)
+	enc.buf.AppendFloat(float64(value), 32)
+}
+
+func (enc *logfmtEncoder) AddInt(key string, value int)     { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt32(key string, value int32) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt16(key string, value int16) { enc.AddInt64(key, int64(value)) }
+func (enc *logfmtEncoder) AddInt8(key string, value int8)   { enc.AddInt64(key, int64(value)) }
+
+func (enc *logfmtEncoder) AddInt64(key string, value int64) {
+	enc.addKey(enc.namespace + key)
+	enc.buf.AppendInt(value)
+}
+
+func (enc *logfmtEncoder) AddString(key, value string) {
+	enc.addKey(enc.namespace + key)
+	enc.appendString(value)
+}
+
+func (enc *logfmtEncoder) AddTime(key string, value time.Time) {
+	enc.addTime(enc.namespace+key, value)
+}
+
+// addTime writes a time with EncodeTime, falling back to RFC3339 if there's
+// no encoder, or it was a no-op.
+func (enc *logfmtEncoder) addTime(key string, value time.Time) {
+	a := enc.value(key)
+	if enc.EncodeTime != nil {
+		enc.EncodeTime(value, a)
+	}
+	if a.n == 0 {
+		a.AppendString(value.Format(time.RFC3339Nano))
+	}
+}
+
+func (enc *logfmtEncoder) AddUint(key string, value uint)       { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint32(key string, value uint32)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint16(key string, value uint16)   { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUint8(key string, value uint8)     { enc.AddUint64(key, uint64(value)) }
+func (enc *logfmtEncoder) AddUintptr(key string, value uintptr) { enc.AddUint64(key, uint64(value)) }
+
+func (enc *logfmtEncoder) AddUint64(key string, value uint64) {
+	enc.addKey(enc.namespace + key)
+	enc.buf.AppendUint(value)
+}
+
+// AddReflected uses reflection to serialize arbitrary objects, so it can be
+// slow and allocation-heavy.
+func (enc *logfmtEncoder) AddReflected(key string, value interface{}) error {
+	return enc.addReflected(enc.namespace+key, value)
+}
+
+// OpenNamespace opens an isolated namespace where all subsequent fields will
+// be added, as keys prefixed with the namespace's name.
+func (enc *logfmtEncoder) OpenNamespace(key string) {
+	enc.namespace += key + "."
+}
+
+// logfmtArrayEncoder writes the elements of an array as separate keys,
+// suffixed with their index.
+type logfmtArrayEncoder struct {
+	enc *logfmtEncoder
+	key string
+	n   int
+	// single is set when writing a single value, such as a time, whose
+	// first element is written without an index.
+	single bool
+}
+
+// nextKey returns the key of the next element, which is relative to the
+// namespace rather than within it.
+func (a *logfmtArrayEncoder) nextKey() string {
+	key := a.key
+	if !a.single || a.n > 0 {
+		key += "." + strconv.Itoa(a.n)
+	}
+	a.n++
+	return key
+}
+
+// addKey writes the key of the next element.
+func (a *logfmtArrayEncoder) addKey() {
+	a.enc.addKey(a.nextKey())
+}
+
+func (a *logfmtArrayEncoder) AppendArray(arr zapcore.ArrayMarshaler) error {
+	key := a.nextKey()
+	nested := &logfmtArrayEncoder{enc: a.enc, key: key}
+	err := arr.MarshalLogArray(nested)
+	if nested.n == 0 {
+		a.enc.addKey(key)
+		a.enc.buf.AppendString("[]")
+	}
+	return err
+}
+
+func (a *logfmtArrayEncoder) AppendObject(obj zapcore.ObjectMarshaler) error {
+	namespace := a.enc.namespace
+	a.enc.namespace = a.nextKey() + "."
+	err := obj.MarshalLogObject(a.enc)
+	a.enc.namespace = namespace
+	return err
+}
+
+func (a *logfmtArrayEncoder) AppendReflected(value interface{}) error {
+	return a.enc.addReflected(a.nextKey(), value)
+}
+
+func (a *logfmtArrayEncoder) AppendBool(value bool) {
+	a.addKey()
+	a.enc.buf.AppendBool(value)
+}
+
+func (a *logfmtArrayEncoder) AppendByteString(value []byte) {
+	a.AppendString(string(value))
+}
+
+func (a *logfmtArrayEncoder) AppendComplex128(value complex128) {
+	a.addKey()
+	a.enc.appendComplex(value, 64)
+}
+
+func (a *logfmtArrayEncoder) AppendComplex64(value complex64) {
+	a.addKey()
+	a.enc.appendComplex(complex128(value), 32)
+}
+
+func (a *logfmtArrayEncoder) AppendDuration(value time.Duration) {
+	a.enc.addDuration(a.nextKey(), value)
+}
+
+func (a *logfmtArrayEncoder) AppendFloat64(value float64) {
+	a.addKey()
+	a.enc.buf.AppendFloat(value, 64)
+}
+
+func (a *logfmtArrayEncoder) AppendFloat32(value float32) {
+	a.addKey()
+	a.enc.buf.AppendFloat(float64(value), 32)
+}
+
+func (a *logfmtArrayEncoder) AppendInt(value int)     { a.AppendInt64(int64(value)) }
+func (a *logfmtArrayEncoder) AppendInt32(value int32) { a.AppendInt64(int64(value)) }
+func (a *logfmtArrayEncoder) AppendInt16(value int16) { a.AppendInt64(int64(value)) }
+func (a *logfmtArrayEncoder) AppendInt8(value int8)   { a.AppendInt64(int64(value)) }
+
+func (a *logfmtArrayEncoder) AppendInt64(value int64) {
+	a.addKey()
+	a.enc.buf.AppendInt(value)
+}
+
+func (a *logfmtArrayEncoder) AppendString(value string) {
+	a.addKey()
+	a.enc.appendString(value)
+}
+
+func (a *logfmtArrayEncoder) AppendTime(value time.Time) {
+	a.enc.addTime(a.nextKey(), value)
+}
+
+func (a *logfmtArrayEncoder) AppendUint(value uint)       { a.AppendUint64(uint64(value)) }
+func (a *logfmtArrayEncoder) AppendUint32(value uint32)   { a.AppendUint64(uint64(value)) }
+func (a *logfmtArrayEncoder) AppendUint16(value uint16)   { a.AppendUint64(uint64(value)) }
+func (a *logfmtArrayEncoder) AppendUint8(value uint8)     { a.AppendUint64(uint64(value)) }
+func (a *logfmtArrayEncoder) AppendUintptr(value uintptr) { a.AppendUint64(uint64(value)) }
+
+func (a *logfmtArrayEncoder) AppendUint64(value uint64) {
+	a.addKey()
+	a.enc.buf.AppendUint(value)
+}
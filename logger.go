@@ -1,7 +1,9 @@
 package log
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -44,14 +46,35 @@ func NewNop() *Logger {
 	return zap.NewNop()
 }
 
-// DetectEncoding detects the encoding to use based on PS_DEV_MODE env var.
+// DetectEncoding detects the encoding to use based on the PS_LOG_FORMAT env
+// var, which is one of pretty, json, logfmt, gcp, ecs or datadog. If it's
+// unset, the pretty encoding is used if PS_DEV_MODE is set, and otherwise
+// JSON. As with PS_LOG_LEVEL, an invalid PS_LOG_FORMAT panics.
 func DetectEncoding() string {
+	if v := os.Getenv("PS_LOG_FORMAT"); v != "" {
+		encoding, err := ParseEncoding(v)
+		if err != nil {
+			panic("Invalid PS_LOG_FORMAT value: " + v)
+		}
+		return encoding
+	}
 	if os.Getenv("PS_DEV_MODE") != "" {
 		return PrettyEncoding
 	}
 	return JSONEncoding
 }
 
+// ParseEncoding parses the name of an encoding, which is one of pretty,
+// json, logfmt, gcp, ecs or datadog, ignoring case and surrounding spaces.
+func ParseEncoding(text string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(text)); v {
+	case PrettyEncoding, JSONEncoding, LogfmtEncoding, GCPEncoding, ECSEncoding, DatadogEncoding:
+		return v, nil
+	default:
+		return "", fmt.Errorf("unrecognized encoding: %q", text)
+	}
+}
+
 // DetectBuffering detects both if an override is set with PS_LOG_BUFFERED,
 // and what the override says. The common case would be to entirely disable
 // buffering, and simply setting PS_LOG_BUFFERED=0 would explicitly disable it.
@@ -60,6 +83,30 @@ func DetectBuffering() (bool, bool) {
 	return v == "1", isSet
 }
 
+// DetectOutputPaths returns the output paths set in the comma separated
+// PS_LOG_OUTPUT env var, such as PS_LOG_OUTPUT=stdout. If unset, logs are
+// written to stderr.
+func DetectOutputPaths() []string {
+	return splitPaths(os.Getenv("PS_LOG_OUTPUT"))
+}
+
+// DetectErrorOutputPaths returns the error output paths set in the comma
+// separated PS_LOG_ERROR_OUTPUT env var. If unset, internal errors are
+// written alongside logs.
+func DetectErrorOutputPaths() []string {
+	return splitPaths(os.Getenv("PS_LOG_ERROR_OUTPUT"))
+}
+
+func splitPaths(v string) []string {
+	var paths []string
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
 // ParseLevel parses a level based on the lower-case or all-caps ASCII
 // representation of the log level. If the provided ASCII representation is
 // invalid an error is returned.
@@ -76,9 +123,11 @@ func ParseLevel(text string) (Level, error) {
 }
 
 // DetectLevel returns a the Level based on PS_LOG_LEVEL env var.
+// PS_LOG_LEVEL may also contain Level overrides for named loggers, which
+// are returned by DetectNamedLevels.
 func DetectLevel() Level {
 	// The default, empty string, unmarshals into "info"
-	level, err := ParseLevel(os.Getenv("PS_LOG_LEVEL"))
+	level, _, err := ParseLevels(os.Getenv("PS_LOG_LEVEL"))
 	if err != nil {
 		panic("Invalid PS_LOG_LEVEL value: " + os.Getenv("PS_LOG_LEVEL"))
 	}
@@ -88,6 +137,14 @@ func DetectLevel() Level {
 const (
 	PrettyEncoding = "pretty"
 	JSONEncoding   = "json"
+	LogfmtEncoding = "logfmt"
+	// GCPEncoding is JSON with the field names Google Cloud Logging
+	// expects.
+	GCPEncoding = "gcp"
+	// ECSEncoding is JSON following the Elastic Common Schema.
+	ECSEncoding = "ecs"
+	// DatadogEncoding is JSON with Datadog's reserved attributes.
+	DatadogEncoding = "datadog"
 )
 
 type (
@@ -0,0 +1,389 @@
+package log
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// profile adapts the JSON encoder to the field names a particular log
+// management service expects, for the parts of an entry that can't be
+// renamed with a zapcore.EncoderConfig alone.
+type profile struct {
+	// errorMessageKey and errorStackKey, if set, replace the "error" and
+	// "errorVerbose" keys that Error writes an error under.
+	errorMessageKey string
+	errorStackKey   string
+	// errorKindKey, if set, is the key the type of an error logged with
+	// Error is written under. This is only known for errors logged with an
+	// entry, rather than added to a Logger with With.
+	errorKindKey string
+	// trace, if set, writes the fields for a TraceContext instead of the
+	// trace_id, span_id and trace_flags fields.
+	trace func(enc zapcore.ObjectEncoder, tc TraceContext)
+	// entry, if set, adds fields derived from each entry.
+	entry func(enc zapcore.ObjectEncoder, ent zapcore.Entry)
+}
+
+// profileEncoder is a JSON encoder which applies a profile to the fields
+// added to it.
+//
+// Each entry is written by two JSON encoders, which are joined into one
+// object: head writes the entry itself, the fields the profile derives from
+// it and any trace added with TraceFields, and the embedded encoder holds
+// the fields added with With. That keeps the derived fields and the trace
+// at the top level, rather than in any namespace opened with With. With an
+// empty profile, this is how JSONEncoding is written.
+type profileEncoder struct {
+	profileFields
+	fields     zapcore.Encoder
+	head       zapcore.Encoder
+	lineEnding string
+	// stackKey is the key head writes the stack of an entry under.
+	stackKey string
+}
+
+// newProfileEncoder creates a JSON encoder with cfg, which applies p. Any
+// fields are added to every entry.
+func newProfileEncoder(cfg zapcore.EncoderConfig, p *profile, fields ...Field) zapcore.Encoder {
+	if cfg.LineEnding == "" {
+		cfg.LineEnding = zapcore.DefaultLineEnding
+	}
+	head := zapcore.NewJSONEncoder(cfg)
+	addFields(head, fields)
+	// The fields encoder only writes fields, so all the keys for the parts
+	// of an entry are left empty.
+	enc := zapcore.NewJSONEncoder(zapcore.EncoderConfig{
+		LineEnding:     cfg.LineEnding,
+		EncodeTime:     cfg.EncodeTime,
+		EncodeDuration: cfg.EncodeDuration,
+	})
+	return &profileEncoder{
+		profileFields: profileFields{ObjectEncoder: enc, profile: p},
+		fields:        enc,
+		head:          head,
+		lineEnding:    cfg.LineEnding,
+		stackKey:      cfg.StacktraceKey,
+	}
+}
+
+func (enc *profileEncoder) Clone() zapcore.Encoder {
+	clone := &profileEncoder{
+		profileFields: enc.profileFields,
+		fields:        enc.fields.Clone(),
+		head:          enc.head,
+		lineEnding:    enc.lineEnding,
+		stackKey:      enc.stackKey,
+	}
+	clone.ObjectEncoder = clone.fields
+	return clone
+}
+
+func (enc *profileEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	// The fields are added inline, rather than by the JSON encoder, so
+	// they go through the profile. They're written first, since they
+	// decide some of what head writes.
+	pf := enc.profileFields
+	tail, err := enc.fields.EncodeEntry(zapcore.Entry{}, []Field{Inline(zapcore.ObjectMarshalerFunc(func(oe zapcore.ObjectEncoder) error {
+		pf.ObjectEncoder = oe
+		for _, f := range fields {
+			if f.Type == zapcore.ErrorType && f.Key == errorKey && enc.errorKindKey != "" {
+				pf.AddString(enc.errorKindKey, fmt.Sprintf("%T", f.Interface))
+			}
+			f.AddTo(&pf)
+		}
+		return nil
+	}))})
+	if err != nil {
+		return nil, err
+	}
+	defer tail.Free()
+
+	var derived []Field
+	if pf.trace != nil {
+		tc := *pf.trace
+		derived = append(derived, Inline(zapcore.ObjectMarshalerFunc(func(oe zapcore.ObjectEncoder) error {
+			if enc.profile.trace != nil {
+				enc.profile.trace(oe, tc)
+				return nil
+			}
+			return tc.MarshalLogObject(oe)
+		})))
+	}
+	if enc.entry != nil {
+		derived = append(derived, Inline(zapcore.ObjectMarshalerFunc(func(oe zapcore.ObjectEncoder) error {
+			enc.entry(oe, ent)
+			return nil
+		})))
+	}
+	// The stack of the entry takes the key over from the stack of an
+	// error, so the key is only written once.
+	if pf.errorStack != "" && (ent.Stack == "" || enc.stackKey != enc.errorStackKey) {
+		derived = append(derived, String(enc.errorStackKey, pf.errorStack))
+	}
+	head, err := enc.head.EncodeEntry(ent, derived)
+	if err != nil {
+		return nil, err
+	}
+	defer head.Free()
+
+	return joinObjects(head.Bytes(), tail.Bytes(), enc.lineEnding), nil
+}
+
+// joinObjects joins two JSON objects, each followed by lineEnding, into one.
+func joinObjects(a, b []byte, lineEnding string) *buffer.Buffer {
+	a = bytes.TrimSuffix(a, []byte(lineEnding))
+	b = bytes.TrimSuffix(b, []byte(lineEnding))
+	a, b = a[:len(a)-1], b[1:]
+	buf := bufferpool.Get()
+	buf.Write(a)
+	if len(a) > 1 && len(b) > 1 {
+		buf.AppendByte(',')
+	}
+	buf.Write(b)
+	buf.AppendString(lineEnding)
+	return buf
+}
+
+// profileFields is an ObjectEncoder which applies a profile to the fields
+// added to it.
+type profileFields struct {
+	zapcore.ObjectEncoder
+	*profile
+	// namespaced is set once a namespace is opened, after which fields
+	// are no longer added at the top level.
+	namespaced bool
+	// errorStack is the stack of an error added at the top level, which
+	// is written with the entry rather than where it was added, so it
+	// can give way to the stack of the entry.
+	errorStack string
+	// trace is the TraceContext added with TraceFields, which is written
+	// with the entry so it's at the top level.
+	trace *TraceContext
+}
+
+func (enc *profileFields) AddString(key, value string) {
+	switch {
+	case key == errorKey && enc.errorMessageKey != "":
+		key = enc.errorMessageKey
+	case key == errorKey+"Verbose" && enc.errorStackKey != "":
+		if !enc.namespaced {
+			enc.errorStack = value
+			return
+		}
+		key = enc.errorStackKey
+	}
+	enc.ObjectEncoder.AddString(key, value)
+}
+
+func (enc *profileFields) OpenNamespace(key string) {
+	enc.namespaced = true
+	enc.ObjectEncoder.OpenNamespace(key)
+}
+
+// profiled is implemented by the encoders which apply a profile, so a
+// TraceContext can be written as the profile expects.
+type profiled interface {
+	appliedProfile() *profile
+}
+
+func (enc *profileFields) appliedProfile() *profile {
+	return enc.profile
+}
+
+func (enc *profileFields) setTrace(tc TraceContext) {
+	enc.trace = &tc
+}
+
+// errorKey is the key Error writes an error under.
+const errorKey = "error"
+
+// gcpProfile creates the profile for Google Cloud Logging, see
+// https://cloud.google.com/logging/docs/structured-logging. projectID is
+// used to link entries to their traces.
+func gcpProfile(projectID string) *profile {
+	return &profile{
+		trace: func(enc zapcore.ObjectEncoder, tc TraceContext) {
+			trace := tc.TraceID
+			if projectID != "" {
+				trace = "projects/" + projectID + "/traces/" + tc.TraceID
+			}
+			enc.AddString("logging.googleapis.com/trace", trace)
+			enc.AddString("logging.googleapis.com/spanId", tc.SpanID)
+			enc.AddBool("logging.googleapis.com/trace_sampled", tc.TraceFlags&1 != 0)
+		},
+		entry: func(enc zapcore.ObjectEncoder, ent zapcore.Entry) {
+			if !ent.Caller.Defined {
+				return
+			}
+			enc.AddObject("logging.googleapis.com/sourceLocation", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+				enc.AddString("file", ent.Caller.File)
+				// The line is an int64, which is a string in JSON.
+				enc.AddString("line", strconv.Itoa(ent.Caller.Line))
+				if ent.Caller.Function != "" {
+					enc.AddString("function", ent.Caller.Function)
+				}
+				return nil
+			}))
+		},
+	}
+}
+
+// NewGCPEncoder creates a JSON encoder for Google Cloud Logging, which writes
+// the severity, message, timestamp, source location and trace of each entry
+// as it expects them. projectID is the ID of the project traces are in.
+func NewGCPEncoder(projectID string) zapcore.Encoder {
+	return newProfileEncoder(gcpEncoderConfig, gcpProfile(projectID))
+}
+
+// gcpSeverityEncoder encodes a Level as a Google Cloud Logging severity.
+func gcpSeverityEncoder(l Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch l {
+	case DebugLevel:
+		enc.AppendString("DEBUG")
+	case InfoLevel:
+		enc.AppendString("INFO")
+	case WarnLevel:
+		enc.AppendString("WARNING")
+	case ErrorLevel:
+		enc.AppendString("ERROR")
+	case DPanicLevel:
+		enc.AppendString("CRITICAL")
+	case PanicLevel:
+		enc.AppendString("ALERT")
+	case FatalLevel:
+		enc.AppendString("EMERGENCY")
+	default:
+		enc.AppendString("DEFAULT")
+	}
+}
+
+// ecsVersion is the version of the Elastic Common Schema that ECSEncoding
+// follows.
+const ecsVersion = "1.6.0"
+
+// ecsProfile is the profile for the Elastic Common Schema, see
+// https://www.elastic.co/guide/en/ecs/current/index.html. Elasticsearch
+// expands dotted keys into objects, so they're written as is.
+var ecsProfile = &profile{
+	errorMessageKey: "error.message",
+	errorStackKey:   "error.stack_trace",
+	trace: func(enc zapcore.ObjectEncoder, tc TraceContext) {
+		enc.AddString("trace.id", tc.TraceID)
+		enc.AddString("span.id", tc.SpanID)
+	},
+	entry: func(enc zapcore.ObjectEncoder, ent zapcore.Entry) {
+		if !ent.Caller.Defined {
+			return
+		}
+		enc.AddString("log.origin.file.name", ent.Caller.File)
+		enc.AddInt("log.origin.file.line", ent.Caller.Line)
+		if ent.Caller.Function != "" {
+			enc.AddString("log.origin.function", ent.Caller.Function)
+		}
+	},
+}
+
+// NewECSEncoder creates a JSON encoder for the Elastic Common Schema, which
+// writes the level, logger, caller, timestamp and trace of each entry, and
+// errors logged with Error, under the ECS field names.
+func NewECSEncoder() zapcore.Encoder {
+	return newProfileEncoder(ecsEncoderConfig, ecsProfile, String("ecs.version", ecsVersion))
+}
+
+// DatadogConfig identifies a service in the logs written by
+// DatadogEncoding. Each field defaults to the env var Datadog's libraries use
+// for it.
+type DatadogConfig struct {
+	// Service is the name of the service, from DD_SERVICE.
+	Service string
+	// Env is the environment the service runs in, from DD_ENV.
+	Env string
+	// Version is the version of the service, from DD_VERSION.
+	Version string
+}
+
+// withEnv returns cfg with any unset fields set from their env vars.
+func (cfg DatadogConfig) withEnv() DatadogConfig {
+	if cfg.Service == "" {
+		cfg.Service = os.Getenv("DD_SERVICE")
+	}
+	if cfg.Env == "" {
+		cfg.Env = os.Getenv("DD_ENV")
+	}
+	if cfg.Version == "" {
+		cfg.Version = os.Getenv("DD_VERSION")
+	}
+	return cfg
+}
+
+// datadogProfile is the profile for Datadog's reserved and standard
+// attributes, see https://docs.datadoghq.com/logs/log_configuration/attributes_naming_convention/.
+var datadogProfile = &profile{
+	errorMessageKey: "error.message",
+	errorStackKey:   "error.stack",
+	errorKindKey:    "error.kind",
+	trace: func(enc zapcore.ObjectEncoder, tc TraceContext) {
+		enc.AddString("dd.trace_id", datadogID(tc.TraceID))
+		enc.AddString("dd.span_id", datadogID(tc.SpanID))
+	},
+}
+
+// datadogStatusEncoder encodes a Level as a Datadog status. Datadog doesn't
+// recognize zap's names for the levels above ErrorLevel, so they're mapped
+// to the syslog severities it does.
+func datadogStatusEncoder(l Level, enc zapcore.PrimitiveArrayEncoder) {
+	switch l {
+	case DebugLevel:
+		enc.AppendString("debug")
+	case InfoLevel:
+		enc.AppendString("info")
+	case WarnLevel:
+		enc.AppendString("warn")
+	case ErrorLevel:
+		enc.AppendString("error")
+	case DPanicLevel:
+		enc.AppendString("critical")
+	case PanicLevel:
+		enc.AppendString("alert")
+	case FatalLevel:
+		enc.AppendString("emergency")
+	default:
+		enc.AppendString("info")
+	}
+}
+
+// datadogID converts a W3C trace or span ID to the decimal form Datadog uses
+// to correlate logs with traces, which only has the lower 64 bits of a trace
+// ID. IDs which aren't hex are left as they are.
+func datadogID(id string) string {
+	if len(id) > 16 {
+		id = id[len(id)-16:]
+	}
+	n, err := strconv.ParseUint(id, 16, 64)
+	if err != nil {
+		return id
+	}
+	return strconv.FormatUint(n, 10)
+}
+
+// NewDatadogEncoder creates a JSON encoder for Datadog, which writes the
+// status, logger, trace and errors of each entry using Datadog's attribute
+// names, along with the service, env and version from cfg.
+func NewDatadogEncoder(cfg DatadogConfig) zapcore.Encoder {
+	var fields []Field
+	if cfg.Service != "" {
+		fields = append(fields, String("service", cfg.Service))
+	}
+	if cfg.Env != "" {
+		fields = append(fields, String("env", cfg.Env))
+	}
+	if cfg.Version != "" {
+		fields = append(fields, String("version", cfg.Version))
+	}
+	return newProfileEncoder(datadogEncoderConfig, datadogProfile, fields...)
+}
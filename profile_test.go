@@ -0,0 +1,185 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// stackError is an error with a verbose form, as errors with a stack
+// have, so Error writes it under both the error and errorVerbose keys.
+type stackError struct{}
+
+func (stackError) Error() string { return "bad" }
+
+func (e stackError) Format(s fmt.State, verb rune) {
+	io.WriteString(s, "bad")
+	if s.Flag('+') {
+		io.WriteString(s, "\nerror stack")
+	}
+}
+
+// decodeObject decodes the JSON object in b, failing if any key in it
+// is written more than once.
+func decodeObject(t *testing.T, b []byte) map[string]interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var decode func() interface{}
+	decode = func() interface{} {
+		tok, err := dec.Token()
+		if err != nil {
+			t.Fatalf("%s: %v", b, err)
+		}
+		switch tok {
+		case json.Delim('{'):
+			obj := make(map[string]interface{})
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					t.Fatalf("%s: %v", b, err)
+				}
+				if _, ok := obj[key.(string)]; ok {
+					t.Fatalf("%s: key %q written more than once", b, key)
+				}
+				obj[key.(string)] = decode()
+			}
+			dec.Token()
+			return obj
+		case json.Delim('['):
+			var arr []interface{}
+			for dec.More() {
+				arr = append(arr, decode())
+			}
+			dec.Token()
+			return arr
+		}
+		return tok
+	}
+	obj, ok := decode().(map[string]interface{})
+	if !ok {
+		t.Fatalf("%s: not an object", b)
+	}
+	return obj
+}
+
+func TestProfileEncoders(t *testing.T) {
+	tests := []struct {
+		name string
+		enc  zapcore.Encoder
+		// stack and noStack are the fields wanted in an entry with an
+		// error, with and without the stack of the entry.
+		stack, noStack map[string]interface{}
+	}{
+		{
+			name: "ecs",
+			enc:  NewECSEncoder(),
+			stack: map[string]interface{}{
+				"log.level":            "error",
+				"message":              "boom",
+				"ecs.version":          ecsVersion,
+				"log.origin.file.name": "/src/app/main.go",
+				"log.origin.file.line": json.Number("7"),
+				"error.message":        "bad",
+				"error.stack_trace":    "entry stack",
+			},
+			noStack: map[string]interface{}{
+				"error.message":     "bad",
+				"error.stack_trace": "bad\nerror stack",
+			},
+		},
+		{
+			name: "gcp",
+			enc:  NewGCPEncoder("proj"),
+			stack: map[string]interface{}{
+				"severity": "ERROR",
+				"message":  "boom",
+				"logging.googleapis.com/sourceLocation": map[string]interface{}{
+					"file": "/src/app/main.go",
+					"line": "7",
+				},
+				"error":        "bad",
+				"errorVerbose": "bad\nerror stack",
+				"stacktrace":   "entry stack",
+			},
+			noStack: map[string]interface{}{
+				"error":        "bad",
+				"errorVerbose": "bad\nerror stack",
+			},
+		},
+		{
+			name: "datadog",
+			enc:  NewDatadogEncoder(DatadogConfig{Service: "app"}),
+			stack: map[string]interface{}{
+				"status":        "error",
+				"message":       "boom",
+				"service":       "app",
+				"error.message": "bad",
+				"error.kind":    "log.stackError",
+				"error.stack":   "entry stack",
+			},
+			noStack: map[string]interface{}{
+				"error.message": "bad",
+				"error.kind":    "log.stackError",
+				"error.stack":   "bad\nerror stack",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ent := zapcore.Entry{
+				Level:   ErrorLevel,
+				Message: "boom",
+				Caller:  zapcore.NewEntryCaller(0, "/src/app/main.go", 7, true),
+				Stack:   "entry stack",
+			}
+			for _, stack := range []bool{true, false} {
+				want := tt.stack
+				if !stack {
+					ent.Stack = ""
+					want = tt.noStack
+				}
+				buf, err := tt.enc.EncodeEntry(ent, []Field{Error(stackError{})})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := decodeObject(t, buf.Bytes())
+				buf.Free()
+				for k, v := range want {
+					if fmt.Sprint(got[k]) != fmt.Sprint(v) {
+						t.Errorf("got %s=%v, want %v", k, got[k], v)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProfileEncoderWith(t *testing.T) {
+	// An error added with With is written with the entry, so its stack
+	// still gives way to the stack of the entry.
+	enc := NewECSEncoder()
+	enc.AddString("app", "api")
+	addFields(enc, []Field{Error(stackError{})})
+	clone := enc.Clone()
+	addFields(clone, []Field{Namespace("req"), Error(stackError{})})
+
+	ent := zapcore.Entry{Level: ErrorLevel, Message: "boom", Stack: "entry stack"}
+	buf, err := clone.EncodeEntry(ent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer buf.Free()
+	got := decodeObject(t, buf.Bytes())
+	if got["error.stack_trace"] != "entry stack" {
+		t.Errorf("got error.stack_trace=%v, want the stack of the entry", got["error.stack_trace"])
+	}
+	req, _ := got["req"].(map[string]interface{})
+	if req["error.stack_trace"] != "bad\nerror stack" {
+		t.Errorf("got req.error.stack_trace=%v, want the stack of the error", req["error.stack_trace"])
+	}
+}
@@ -0,0 +1,462 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RotateScheme is the URL scheme for a RotatingFile in Config.OutputPaths
+// or PS_LOG_OUTPUT. The options of RotateOptions are set as query parameters:
+//
+//	rotate:///var/log/app.log?max_size=100MB&max_age=24h&max_backups=5&compress=true
+const RotateScheme = "rotate"
+
+// backupTimeFormat is the timestamp added to the name of rotated files.
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateOptions controls when a RotatingFile is rotated, and what's kept.
+type RotateOptions struct {
+	// MaxSize is the size in bytes the file can grow to before being
+	// rotated. Zero disables rotating by size.
+	MaxSize int64
+	// MaxAge is how long the file is written to before being rotated.
+	// Zero disables rotating by age.
+	//
+	// When an existing file is opened, such as after a restart, its age is
+	// counted from the newest backup, which was rotated when the file was
+	// started. The start of a file with no backups isn't recorded, so its
+	// age is counted from when it was last written to, and a file that's
+	// written to by a service that restarts more often than MaxAge is never
+	// rotated by age until it has a backup.
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files to keep. Zero keeps all of
+	// them.
+	MaxBackups int
+	// Compress gzips rotated files.
+	Compress bool
+}
+
+// RotatingFile is a zapcore.WriteSyncer which writes to a file, rotating it
+// according to its RotateOptions. Rotated files are renamed with the time of
+// rotation, so app.log is rotated to app-2006-01-02T15-04-05.000.log.
+//
+// The file is also reopened on SIGHUP, so it can be used alongside an
+// external logrotate which moves the file out of the way.
+type RotatingFile struct {
+	filename string
+	opts     RotateOptions
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+
+	// mill serializes compressing and removing old backups, which are
+	// done in the background so writes aren't blocked.
+	mill sync.Mutex
+	wg   sync.WaitGroup
+
+	sighup chan os.Signal
+	done   chan struct{}
+	closed bool
+}
+
+// NewRotatingFile opens filename for appending, creating it if necessary,
+// and returns a RotatingFile writing to it. Close should be called to stop
+// listening for SIGHUP once it's no longer needed.
+func NewRotatingFile(filename string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{
+		filename: filename,
+		opts:     opts,
+		sighup:   make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	signal.Notify(f.sighup, syscall.SIGHUP)
+	go f.reopenOnSIGHUP()
+	return f, nil
+}
+
+func (f *RotatingFile) reopenOnSIGHUP() {
+	for {
+		select {
+		case <-f.sighup:
+			if err := f.Reopen(); err != nil {
+				fmt.Fprintf(os.Stderr, "%v failed to reopen log file: %v\n", time.Now(), err)
+			}
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// open opens the file, with f.mu held.
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.filename), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	if f.size > 0 {
+		f.openedAt = f.startedAt(info)
+	}
+	return nil
+}
+
+// startedAt returns when an existing file was started, so its age carries
+// over when it's reopened. That's when it was last rotated, if that's known,
+// or otherwise when it was last written to, since the time a file was
+// created isn't available on every platform, notably Linux.
+func (f *RotatingFile) startedAt(info os.FileInfo) time.Time {
+	backups, err := f.backups()
+	if err == nil && len(backups) > 0 && backups[0].t.Before(info.ModTime()) {
+		return backups[0].t
+	}
+	return info.ModTime()
+}
+
+// Write implements io.Writer, rotating the file first if the write would
+// exceed MaxSize, or the file is older than MaxAge.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	// A previous rotation may have failed to open the new file.
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return 0, err
+		}
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	// Never rotate an empty file, otherwise a single write larger than
+	// MaxSize would rotate on every write.
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && time.Since(f.openedAt) >= f.opts.MaxAge
+}
+
+// Rotate closes the current file, renames it with a timestamp, and opens a
+// new file in its place.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// rotate rotates the file, with f.mu held.
+func (f *RotatingFile) rotate() error {
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.filename, f.backupName(time.Now())); err != nil {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	if f.opts.Compress || f.opts.MaxBackups > 0 {
+		f.wg.Add(1)
+		go func() {
+			defer f.wg.Done()
+			f.millBackups()
+		}()
+	}
+	return nil
+}
+
+// Reopen closes and reopens the file without rotating it. This is used when
+// the file has been moved by something else, such as logrotate.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if err := f.closeFile(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Sync implements zapcore.WriteSyncer.
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed || f.file == nil {
+		return nil
+	}
+	return f.file.Sync()
+}
+
+// closeFile closes the file, with f.mu held.
+func (f *RotatingFile) closeFile() error {
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// Close stops listening for SIGHUP, waits for any background compression
+// to finish, and closes the file. It's safe to call Close more than once.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	signal.Stop(f.sighup)
+	close(f.done)
+	err := f.closeFile()
+	f.mu.Unlock()
+
+	f.wg.Wait()
+	return err
+}
+
+// backupName returns the name to rotate the file to at t. Names only have
+// millisecond resolution, so if one is already taken, the next free
+// millisecond is used instead.
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	for {
+		name := filepath.Join(dir, prefix+t.Format(backupTimeFormat)+ext)
+		if !fileExists(name) && !fileExists(name+".gz") {
+			return name
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func (f *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(f.filename)
+	base := filepath.Base(f.filename)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+type backup struct {
+	path string
+	t    time.Time
+}
+
+// millBackups compresses, and removes the oldest, rotated files.
+func (f *RotatingFile) millBackups() {
+	f.mill.Lock()
+	defer f.mill.Unlock()
+
+	backups, err := f.backups()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v failed to list rotated log files: %v\n", time.Now(), err)
+		return
+	}
+
+	if f.opts.MaxBackups > 0 && len(backups) > f.opts.MaxBackups {
+		for _, b := range backups[f.opts.MaxBackups:] {
+			if err := os.Remove(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "%v failed to remove rotated log file: %v\n", time.Now(), err)
+			}
+		}
+		backups = backups[:f.opts.MaxBackups]
+	}
+
+	if f.opts.Compress {
+		for _, b := range backups {
+			if strings.HasSuffix(b.path, ".gz") {
+				continue
+			}
+			if err := gzipFile(b.path); err != nil {
+				fmt.Fprintf(os.Stderr, "%v failed to compress rotated log file: %v\n", time.Now(), err)
+			}
+		}
+	}
+}
+
+// backups returns the rotated files, newest first.
+func (f *RotatingFile) backups() ([]backup, error) {
+	dir, prefix, ext := f.nameParts()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimSuffix(strings.TrimSuffix(name[len(prefix):], ".gz"), ext)
+		t, err := time.ParseInLocation(backupTimeFormat, ts, time.Local)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), t: t})
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].t.After(backups[j].t)
+	})
+	return backups, nil
+}
+
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = writeGzip(path+".gz", src)
+	src.Close()
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+func writeGzip(path string, r io.Reader) error {
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, r); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// ParseRotateURL parses the path and RotateOptions out of a rotate:// URL.
+func ParseRotateURL(u *url.URL) (string, RotateOptions, error) {
+	var opts RotateOptions
+	if u.Scheme != RotateScheme {
+		return "", opts, fmt.Errorf("unexpected scheme %q for rotating file", u.Scheme)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", opts, fmt.Errorf("rotating file URLs must not have a host: %q", u.String())
+	}
+	if u.Path == "" {
+		return "", opts, fmt.Errorf("rotating file URLs must have a path: %q", u.String())
+	}
+
+	q := u.Query()
+	var err error
+	if v := q.Get("max_size"); v != "" {
+		if opts.MaxSize, err = parseSize(v); err != nil {
+			return "", opts, fmt.Errorf("invalid max_size %q: %w", v, err)
+		}
+	}
+	if v := q.Get("max_age"); v != "" {
+		if opts.MaxAge, err = time.ParseDuration(v); err != nil {
+			return "", opts, fmt.Errorf("invalid max_age %q: %w", v, err)
+		}
+	}
+	if v := q.Get("max_backups"); v != "" {
+		if opts.MaxBackups, err = strconv.Atoi(v); err != nil {
+			return "", opts, fmt.Errorf("invalid max_backups %q: %w", v, err)
+		}
+	}
+	if v := q.Get("compress"); v != "" {
+		if opts.Compress, err = strconv.ParseBool(v); err != nil {
+			return "", opts, fmt.Errorf("invalid compress %q: %w", v, err)
+		}
+	}
+	return u.Path, opts, nil
+}
+
+// parseSize parses a size in bytes, with an optional KB, MB or GB suffix
+// in powers of 1024.
+func parseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mult   int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			mult = unit.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("size must not be negative")
+	}
+	return n * mult, nil
+}
+
+func init() {
+	if err := zap.RegisterSink(RotateScheme, func(u *url.URL) (zap.Sink, error) {
+		filename, opts, err := ParseRotateURL(u)
+		if err != nil {
+			return nil, err
+		}
+		return NewRotatingFile(filename, opts)
+	}); err != nil {
+		panic(err)
+	}
+}
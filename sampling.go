@@ -0,0 +1,203 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// SamplingConfig configures sampling of repeated entries. Within each Tick,
+// the first Initial entries with a given level and message are logged, and
+// after that only every Thereafter'th entry is logged. If both are zero,
+// they default to 100, as with zap.NewProductionConfig.
+type SamplingConfig struct {
+	Initial    int
+	Thereafter int
+	// Tick is the period sampling is counted over. Defaults to a second.
+	Tick time.Duration
+	// ExemptWarn exempts entries at WarnLevel and above from sampling, so
+	// they're always logged.
+	ExemptWarn bool
+	// OnDropped, if set, is called once per Tick for each level and message
+	// that had entries dropped during it, with the number dropped. It's also
+	// called for whatever's outstanding when the logger is closed.
+	OnDropped func(level Level, msg string, dropped uint64)
+}
+
+// ParseSampling parses a SamplingConfig from a comma separated list of
+// key=value pairs, such as:
+//
+//	initial=100,thereafter=100,tick=1s,exempt_warn=true
+//
+// initial and thereafter default to 100 when left out.
+func ParseSampling(text string) (*SamplingConfig, error) {
+	cfg := &SamplingConfig{
+		Initial:    defaultSamplingInitial,
+		Thereafter: defaultSamplingThereafter,
+	}
+	for _, part := range strings.Split(text, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected key=value, got %q", part)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "initial":
+			cfg.Initial, err = strconv.Atoi(value)
+		case "thereafter":
+			cfg.Thereafter, err = strconv.Atoi(value)
+		case "tick":
+			cfg.Tick, err = time.ParseDuration(value)
+		case "exempt_warn":
+			cfg.ExemptWarn, err = strconv.ParseBool(value)
+		default:
+			return nil, fmt.Errorf("unknown sampling option %q", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling option %q: %w", key, err)
+		}
+	}
+	return cfg, nil
+}
+
+// DetectSampling returns the SamplingConfig set in the PS_LOG_SAMPLING env
+// var, in the format parsed by ParseSampling. Sampling is disabled, and nil
+// is returned, if it isn't set.
+func DetectSampling() *SamplingConfig {
+	v := os.Getenv("PS_LOG_SAMPLING")
+	if v == "" {
+		return nil
+	}
+	cfg, err := ParseSampling(v)
+	if err != nil {
+		panic("Invalid PS_LOG_SAMPLING value: " + v)
+	}
+	return cfg
+}
+
+// The defaults for SamplingConfig.Initial and Thereafter, as used by
+// zap.NewProductionConfig.
+const (
+	defaultSamplingInitial    = 100
+	defaultSamplingThereafter = 100
+)
+
+// wrap wraps core with a sampler, registering anything which needs to be
+// stopped with s.
+func (cfg *SamplingConfig) wrap(core zapcore.Core, s *sinks) zapcore.Core {
+	tick := cfg.Tick
+	if tick <= 0 {
+		tick = time.Second
+	}
+	initial, thereafter := cfg.Initial, cfg.Thereafter
+	if initial == 0 && thereafter == 0 {
+		initial, thereafter = defaultSamplingInitial, defaultSamplingThereafter
+	}
+
+	var opts []zapcore.SamplerOption
+	if cfg.OnDropped != nil {
+		d := newDroppedCounter(cfg.OnDropped)
+		opts = append(opts, zapcore.SamplerHook(d.hook))
+		s.closers = append(s.closers, d.start(tick))
+	}
+	sampled := zapcore.NewSamplerWithOptions(core, tick, initial, thereafter, opts...)
+	if cfg.ExemptWarn {
+		return &exemptCore{Core: core, sampled: sampled}
+	}
+	return sampled
+}
+
+// exemptCore is a zapcore.Core which only samples entries below WarnLevel.
+type exemptCore struct {
+	zapcore.Core
+	sampled zapcore.Core
+}
+
+func (c *exemptCore) With(fields []Field) zapcore.Core {
+	return &exemptCore{
+		Core:    c.Core.With(fields),
+		sampled: c.sampled.With(fields),
+	}
+}
+
+func (c *exemptCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= WarnLevel {
+		return c.Core.Check(ent, ce)
+	}
+	return c.sampled.Check(ent, ce)
+}
+
+type droppedKey struct {
+	level Level
+	msg   string
+}
+
+// droppedCounter counts entries dropped by a sampler, per level and message.
+type droppedCounter struct {
+	fn func(level Level, msg string, dropped uint64)
+
+	mu     sync.Mutex
+	counts map[droppedKey]uint64
+}
+
+func newDroppedCounter(fn func(Level, string, uint64)) *droppedCounter {
+	return &droppedCounter{
+		fn:     fn,
+		counts: make(map[droppedKey]uint64),
+	}
+}
+
+func (d *droppedCounter) hook(ent zapcore.Entry, dec zapcore.SamplingDecision) {
+	if dec&zapcore.LogDropped == 0 {
+		return
+	}
+	d.mu.Lock()
+	d.counts[droppedKey{level: ent.Level, msg: ent.Message}]++
+	d.mu.Unlock()
+}
+
+func (d *droppedCounter) report() {
+	d.mu.Lock()
+	counts := d.counts
+	d.counts = make(map[droppedKey]uint64, len(counts))
+	d.mu.Unlock()
+
+	for k, dropped := range counts {
+		d.fn(k.level, k.msg, dropped)
+	}
+}
+
+// start reports dropped entries every tick, until the returned function is
+// called, which also reports what's outstanding.
+func (d *droppedCounter) start(tick time.Duration) func() {
+	ticker := time.NewTicker(tick)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-ticker.C:
+				d.report()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+		<-stopped
+		d.report()
+	}
+}
@@ -0,0 +1,75 @@
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// DetectFlushOnSignal detects if PS_LOG_FLUSH_ON_SIGNAL=1 is set, which
+// sets Config.FlushOnSignal.
+func DetectFlushOnSignal() bool {
+	return os.Getenv("PS_LOG_FLUSH_ON_SIGNAL") == "1"
+}
+
+// flushOnSignal closes the sinks on SIGINT or SIGTERM, and then re-raises
+// the signal so the process is terminated as it would have been otherwise.
+//
+// Since the signal is re-raised, this is intended for processes which don't
+// handle these signals themselves. A process with its own graceful shutdown
+// should instead call the close function from BuildWithCloser once it's done.
+func (s *sinks) flushOnSignal() {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	s.closers = append(s.closers, func() {
+		signal.Stop(sigs)
+		close(done)
+	})
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			s.Close()
+			reraise(sig)
+		case <-done:
+		}
+	}()
+}
+
+// reraise sends sig to the current process, once it's no longer being
+// notified of it, so that the default action for sig is taken.
+func reraise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		// Not every platform can signal itself, so exit as close to
+		// how the signal would have as we can.
+		os.Exit(1)
+	}
+}
+
+// OnWrite implements zapcore.CheckWriteHook. This is installed as the fatal
+// hook, so the sinks are flushed and closed before the process exits.
+func (s *sinks) OnWrite(*zapcore.CheckedEntry, []Field) {
+	s.Close()
+	os.Exit(1)
+}
+
+// FlushOnPanic flushes a logger if the goroutine is panicking, and then
+// continues panicking. This must be deferred directly, such as at the top of
+// main or of a goroutine, with the close function from BuildWithCloser:
+//
+//	logger, closeLogger, err := cfg.BuildWithCloser()
+//	...
+//	defer log.FlushOnPanic(closeLogger)
+func FlushOnPanic(flush func() error) {
+	if r := recover(); r != nil {
+		flush()
+		panic(r)
+	}
+}
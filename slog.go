@@ -0,0 +1,269 @@
+//go:build go1.21
+
+package log
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"runtime"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// NewSlog creates an opinionated *slog.Logger which shares the configuration,
+// and output, of New.
+func NewSlog() *slog.Logger {
+	return NewSlogAtLevel(DetectLevel())
+}
+
+// NewSlogAtLevel creates an opinionated *slog.Logger at a desired Level.
+func NewSlogAtLevel(l Level) *slog.Logger {
+	h, err := NewPlanetScaleConfig(DetectEncoding(), l).BuildSlogHandler()
+	if err != nil {
+		panic("Unexpected error initializing PlanetScale slog handler: " + err.Error())
+	}
+	return slog.New(h)
+}
+
+// BuildSlogHandler creates a SlogHandler out of our Config. Records are
+// written through the same core as a Logger created by Build, so the
+// output is identical between the two.
+func (cfg Config) BuildSlogHandler() (*SlogHandler, error) {
+	h, _, err := cfg.BuildSlogHandlerWithCloser()
+	return h, err
+}
+
+// BuildSlogHandlerWithCloser creates a SlogHandler out of our Config, along
+// with a function to close it, as with BuildWithCloser.
+func (cfg Config) BuildSlogHandlerWithCloser() (*SlogHandler, func() error, error) {
+	s, err := cfg.openSinks()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &SlogHandler{
+		core:        cfg.buildCore(s),
+		errorOutput: s.errOut,
+	}, s.Close, nil
+}
+
+// SlogHandler is a slog.Handler that writes records to a zapcore.Core.
+//
+// Groups opened with WithGroup are encoded as zap namespaces, so they nest
+// as objects in JSON output. Like slog's own handlers, a group is omitted
+// entirely if no attributes are ever added to it.
+type SlogHandler struct {
+	core        zapcore.Core
+	errorOutput zapcore.WriteSyncer
+	// groups holds the groups which have been opened, but that don't yet
+	// have any attributes, and thus haven't been added to the core.
+	groups []string
+}
+
+var _ slog.Handler = (*SlogHandler)(nil)
+
+// NewSlogHandler wraps a zapcore.Core to implement the slog.Handler interface.
+// For a Logger, this would be NewSlogHandler(logger.Core()).
+func NewSlogHandler(core zapcore.Core) *SlogHandler {
+	return &SlogHandler{
+		core:        core,
+		errorOutput: zapcore.Lock(os.Stderr),
+	}
+}
+
+// Enabled implements slog.Handler.
+func (h *SlogHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return h.core.Enabled(slogLevelToLevel(l))
+}
+
+// Handle implements slog.Handler.
+// The trace correlation fields of the span active in ctx, if any, are
+// added to the entry alongside the record's attributes.
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	ent := zapcore.Entry{
+		Level:   slogLevelToLevel(r.Level),
+		Time:    r.Time,
+		Message: r.Message,
+	}
+	ce := h.core.Check(ent, nil)
+	if ce == nil {
+		return nil
+	}
+	ce.ErrorOutput = h.errorOutput
+
+	if r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		ce.Entry.Caller = zapcore.EntryCaller{
+			Defined:  frame.PC != 0,
+			PC:       frame.PC,
+			File:     frame.File,
+			Line:     frame.Line,
+			Function: frame.Function,
+		}
+	}
+	// Mirror zap.AddStacktrace(ErrorLevel) from Config.Build.
+	if ce.Entry.Level >= ErrorLevel {
+		ce.Entry.Stack = slogStacktrace(r.PC)
+	}
+
+	fields := make([]Field, 0, r.NumAttrs())
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendSlogAttr(fields, a)
+		return true
+	})
+	if len(fields) > 0 && len(h.groups) > 0 {
+		fields = append(h.namespaces(), fields...)
+	}
+	// Trace fields are added before any namespaces are opened, so that
+	// they're always at the top level of the entry.
+	if traceFields := TraceFields(ctx); len(traceFields) > 0 {
+		fields = append(traceFields, fields...)
+	}
+
+	ce.Write(fields...)
+	return nil
+}
+
+// WithAttrs implements slog.Handler.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	fields := make([]Field, 0, len(attrs))
+	for _, a := range attrs {
+		fields = appendSlogAttr(fields, a)
+	}
+	if len(fields) == 0 {
+		return h
+	}
+	clone := *h
+	clone.core = h.core.With(append(h.namespaces(), fields...))
+	clone.groups = nil
+	return &clone
+}
+
+// WithGroup implements slog.Handler.
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.groups = append(h.groups[:len(h.groups):len(h.groups)], name)
+	return &clone
+}
+
+func (h *SlogHandler) namespaces() []Field {
+	fields := make([]Field, 0, len(h.groups))
+	for _, g := range h.groups {
+		fields = append(fields, Namespace(g))
+	}
+	return fields
+}
+
+// slogLevelToLevel maps a slog.Level onto the nearest Level at or below it.
+// slog has no equivalent of the DPanic, Panic or Fatal levels, so anything
+// above slog.LevelError is treated as ErrorLevel.
+func slogLevelToLevel(l slog.Level) Level {
+	switch {
+	case l >= slog.LevelError:
+		return ErrorLevel
+	case l >= slog.LevelWarn:
+		return WarnLevel
+	case l >= slog.LevelInfo:
+		return InfoLevel
+	default:
+		return DebugLevel
+	}
+}
+
+// appendSlogAttr converts a slog.Attr into Fields, following the slog.Handler
+// rules: values are resolved, attributes without a key are dropped, empty
+// groups are dropped, and groups without a key are inlined.
+func appendSlogAttr(fields []Field, a slog.Attr) []Field {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return fields
+		}
+		if a.Key == "" {
+			for _, ga := range attrs {
+				fields = appendSlogAttr(fields, ga)
+			}
+			return fields
+		}
+		return append(fields, Object(a.Key, slogGroup(attrs)))
+	}
+	if a.Key == "" {
+		return fields
+	}
+
+	switch v.Kind() {
+	case slog.KindString:
+		return append(fields, String(a.Key, v.String()))
+	case slog.KindInt64:
+		return append(fields, Int64(a.Key, v.Int64()))
+	case slog.KindUint64:
+		return append(fields, Uint64(a.Key, v.Uint64()))
+	case slog.KindFloat64:
+		return append(fields, Float64(a.Key, v.Float64()))
+	case slog.KindBool:
+		return append(fields, Bool(a.Key, v.Bool()))
+	case slog.KindDuration:
+		return append(fields, Duration(a.Key, v.Duration()))
+	case slog.KindTime:
+		return append(fields, Time(a.Key, v.Time()))
+	}
+
+	if err, ok := v.Any().(error); ok {
+		return append(fields, NamedError(a.Key, err))
+	}
+	return append(fields, Any(a.Key, v.Any()))
+}
+
+// slogGroup marshals the attributes of a slog group as a zap object.
+type slogGroup []slog.Attr
+
+func (g slogGroup) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	var fields []Field
+	for _, a := range g {
+		fields = appendSlogAttr(fields, a)
+	}
+	addFields(enc, fields)
+	return nil
+}
+
+// slogStacktrace formats the current goroutine's stack in the same format as
+// zap, starting at the frame which logged the record so that the frames of
+// slog, and this handler, are omitted.
+func slogStacktrace(pc uintptr) string {
+	pcs := make([]uintptr, 64)
+	for {
+		n := runtime.Callers(2, pcs)
+		if n < len(pcs) {
+			pcs = pcs[:n]
+			break
+		}
+		pcs = make([]uintptr, len(pcs)*2)
+	}
+	for i := range pcs {
+		if pcs[i] == pc {
+			pcs = pcs[i:]
+			break
+		}
+	}
+
+	buf := bufferpool.Get()
+	defer buf.Free()
+
+	frames := runtime.CallersFrames(pcs)
+	// Like zap, skip the final runtime.main/runtime.goexit frame.
+	for frame, more := frames.Next(); more; frame, more = frames.Next() {
+		if buf.Len() > 0 {
+			buf.AppendByte('\n')
+		}
+		buf.AppendString(frame.Function)
+		buf.AppendString("\n\t")
+		buf.AppendString(frame.File)
+		buf.AppendByte(':')
+		buf.AppendInt(int64(frame.Line))
+	}
+	return buf.String()
+}
@@ -0,0 +1,183 @@
+package log
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// syslogListener is a syslog server for tests, which returns each message
+// it receives from read.
+type syslogListener struct {
+	network string
+	address string
+	read    func(t *testing.T) string
+}
+
+func listenSyslogPacket(t *testing.T, network, address string) syslogListener {
+	conn, err := net.ListenPacket(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return syslogListener{
+		network: network,
+		address: conn.LocalAddr().String(),
+		read: func(t *testing.T) string {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			b := make([]byte, 64<<10)
+			n, _, err := conn.ReadFrom(b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(b[:n])
+		},
+	}
+}
+
+func listenSyslogStream(t *testing.T, network, address string) syslogListener {
+	l, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	var r *bufio.Reader
+	return syslogListener{
+		network: network,
+		address: l.Addr().String(),
+		read: func(t *testing.T) string {
+			if r == nil {
+				conn, err := l.Accept()
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { conn.Close() })
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				r = bufio.NewReader(conn)
+			}
+			// Messages are framed by octet counting.
+			size, err := r.ReadString(' ')
+			if err != nil {
+				t.Fatal(err)
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+			if err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, n)
+			if _, err := io.ReadFull(r, b); err != nil {
+				t.Fatal(err)
+			}
+			return string(b)
+		},
+	}
+}
+
+func TestSyslogCore(t *testing.T) {
+	tests := []struct {
+		name   string
+		listen func(t *testing.T) syslogListener
+	}{
+		{"udp", func(t *testing.T) syslogListener {
+			return listenSyslogPacket(t, "udp", "127.0.0.1:0")
+		}},
+		{"tcp", func(t *testing.T) syslogListener {
+			return listenSyslogStream(t, "tcp", "127.0.0.1:0")
+		}},
+		{"unixgram", func(t *testing.T) syslogListener {
+			l := listenSyslogPacket(t, "unixgram", filepath.Join(t.TempDir(), "log"))
+			l.network = "unix"
+			return l
+		}},
+		{"unix", func(t *testing.T) syslogListener {
+			return listenSyslogStream(t, "unix", filepath.Join(t.TempDir(), "log"))
+		}},
+	}
+	ent := zapcore.Entry{
+		Level:      WarnLevel,
+		Time:       time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC),
+		LoggerName: "db",
+		Message:    "slow query",
+	}
+	fields := []Field{
+		Int("rows", 3),
+		Any("query", map[string]interface{}{"table": "users", "args": []int{1, 2}}),
+	}
+	const header = "<132>1 2022-08-01T12:00:00.000000Z host app "
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if strings.HasPrefix(tt.name, "unix") && runtime.GOOS == "windows" {
+				t.Skip("unix sockets aren't supported on windows")
+			}
+			for _, structured := range []bool{false, true} {
+				l := tt.listen(t)
+				core, close := NewSyslogCore(SyslogConfig{
+					Network:        l.network,
+					Address:        l.address,
+					Facility:       SyslogLocal0,
+					AppName:        "app",
+					Hostname:       "host",
+					StructuredData: structured,
+				}, DebugLevel)
+				defer close()
+
+				if err := core.With([]Field{String("shard", "-80")}).Write(ent, fields); err != nil {
+					t.Fatal(err)
+				}
+				got := l.read(t)
+				if !strings.HasPrefix(got, header) {
+					t.Errorf("got header %q, want %q", got, header)
+				}
+				want := ` - - {"logger":"db","msg":"slow query","shard":"-80","rows":3,"query":{"args":[1,2],"table":"users"}}`
+				if structured {
+					want = ` - [fields@32473 logger="db" query.args.0="1" query.args.1="2" query.table="users" rows="3" shard="-80"] slow query`
+				}
+				if !strings.HasSuffix(got, want) {
+					t.Errorf("got %q, want it to end with %q", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFlattenFields(t *testing.T) {
+	type point struct {
+		X, Y int
+	}
+	enc := zapcore.NewMapObjectEncoder()
+	addFields(enc, []Field{
+		Any("point", point{1, 2}),
+		Any("map", map[string]int{"x": 1}),
+		Any("empty", map[string]int{}),
+		Binary("bin", []byte("hi")),
+		Duration("elapsed", time.Second),
+		Float64("ratio", 0.5),
+	})
+	params := make(map[string]string)
+	flattenFields(params, "", enc.Fields)
+	want := map[string]string{
+		"point.X": "1",
+		"point.Y": "2",
+		"map.x":   "1",
+		"empty":   "{}",
+		"bin":     "aGk=",
+		"elapsed": "1s",
+		"ratio":   "0.5",
+	}
+	if len(params) != len(want) {
+		t.Errorf("got %v, want %v", params, want)
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("got %s=%q, want %q", k, params[k], v)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package log
+
+import "os"
+
+// ttyWidth returns zero, since there's no portable way to ask a terminal for
+// its width.
+func ttyWidth(f *os.File) int {
+	return 0
+}
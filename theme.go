@@ -0,0 +1,156 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Style is a set of ANSI SGR parameters, separated by semicolons, such as
+// "1;31" for bold red text. An empty Style leaves text unstyled.
+type Style string
+
+// newStyle creates a Style out of attributes.
+func newStyle(as ...attribute) Style {
+	var b strings.Builder
+	for i, a := range as {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(strconv.Itoa(int(a)))
+	}
+	return Style(b.String())
+}
+
+// newStyle256 creates a Style for the foreground color n of the 256 color
+// palette, which most terminals support, for shades the 16 base colors
+// don't have.
+func newStyle256(n uint8) Style {
+	return Style("38;5;" + strconv.Itoa(int(n)))
+}
+
+// Theme is the set of Styles used by the pretty encoder.
+type Theme struct {
+	Time Style
+
+	// Debug through Fatal are the Styles for each Level. Panic is used for
+	// both DPanicLevel and PanicLevel.
+	Debug Style
+	Info  Style
+	Warn  Style
+	Error Style
+	Panic Style
+	Fatal Style
+
+	Message    Style
+	Key        Style
+	Caller     Style
+	Stacktrace Style
+
+	// StackModule and StackStdlib are the Styles for stack frames from
+	// the main module, and from the standard library.
+	StackModule Style
+	StackStdlib Style
+}
+
+// level returns the Style for l.
+func (t *Theme) level(l Level) Style {
+	switch l {
+	case DebugLevel:
+		return t.Debug
+	case InfoLevel:
+		return t.Info
+	case WarnLevel:
+		return t.Warn
+	case ErrorLevel:
+		return t.Error
+	case DPanicLevel, PanicLevel:
+		return t.Panic
+	case FatalLevel:
+		return t.Fatal
+	}
+	return ""
+}
+
+var (
+	// ThemeDark is the default Theme, for terminals with a dark background.
+	ThemeDark = Theme{
+		Time:       newStyle256(250), // light grey
+		Debug:      newStyle(attributeFgMagenta),
+		Info:       newStyle(attributeFgCyan),
+		Warn:       newStyle(attributeFgYellow),
+		Error:      newStyle(attributeFgRed),
+		Panic:      newStyle(attributeBgRed),
+		Fatal:      newStyle(attributeBgHiRed, attributeFgHiWhite),
+		Key:        newStyle(attributeFgGreen),
+		Caller:     newStyle256(244), // grey
+		Stacktrace: newStyle(attributeFgRed),
+
+		StackModule: newStyle(attributeBold, attributeFgHiWhite),
+		StackStdlib: newStyle(attributeFgHiBlack),
+	}
+
+	// ThemeLight is a Theme for terminals with a light background, which
+	// avoids the colors that are unreadable on one, like white and yellow.
+	ThemeLight = Theme{
+		Time:       newStyle(attributeFgHiBlack),
+		Debug:      newStyle(attributeFgMagenta),
+		Info:       newStyle(attributeFgBlue),
+		Warn:       newStyle(attributeBgYellow, attributeFgBlack),
+		Error:      newStyle(attributeFgRed),
+		Panic:      newStyle(attributeBgRed, attributeFgHiWhite),
+		Fatal:      newStyle(attributeBgHiRed, attributeFgHiWhite),
+		Key:        newStyle256(28), // dark green, since green is faint on white
+		Caller:     newStyle(attributeFgHiBlack),
+		Stacktrace: newStyle(attributeFgRed),
+
+		StackModule: newStyle(attributeBold),
+		StackStdlib: newStyle(attributeFgHiBlack),
+	}
+
+	// ThemeMonochrome is a Theme which only uses bold, faint and reversed
+	// text, for terminals without colors, or people who don't like them.
+	ThemeMonochrome = Theme{
+		Time:       newStyle(attributeFaint),
+		Debug:      newStyle(attributeFaint),
+		Warn:       newStyle(attributeBold),
+		Error:      newStyle(attributeBold),
+		Panic:      newStyle(attributeReverse),
+		Fatal:      newStyle(attributeBold, attributeReverse),
+		Key:        newStyle(attributeFaint),
+		Caller:     newStyle(attributeFaint),
+		Stacktrace: newStyle(attributeBold),
+
+		StackModule: newStyle(attributeBold),
+		StackStdlib: newStyle(attributeFaint),
+	}
+)
+
+// ParseTheme returns a copy of the built-in Theme called name, which is one
+// of dark, light or monochrome, so it can be changed without affecting
+// anything else using it. An empty name is ThemeDark.
+func ParseTheme(name string) (*Theme, error) {
+	var t Theme
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "dark":
+		t = ThemeDark
+	case "light":
+		t = ThemeLight
+	case "monochrome":
+		t = ThemeMonochrome
+	default:
+		return nil, fmt.Errorf("unrecognized theme: %q", name)
+	}
+	return &t, nil
+}
+
+// DetectTheme returns the built-in Theme named by the PS_LOG_THEME env var,
+// which is one of dark, light or monochrome. Defaults to dark.
+func DetectTheme() *Theme {
+	theme, err := ParseTheme(os.Getenv("PS_LOG_THEME"))
+	if err != nil {
+		panic("Invalid PS_LOG_THEME value: " + os.Getenv("PS_LOG_THEME"))
+	}
+	return theme
+}
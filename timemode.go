@@ -0,0 +1,47 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TimeMode controls how the pretty encoder displays the time of each entry.
+type TimeMode string
+
+const (
+	// TimeElapsed displays the time elapsed since the logger was created.
+	TimeElapsed TimeMode = "elapsed"
+	// TimeLocal displays the wall clock time in the local time zone.
+	TimeLocal TimeMode = "local"
+	// TimeUTC displays the wall clock time in UTC.
+	TimeUTC TimeMode = "utc"
+	// TimeDelta displays the time since the previous entry.
+	TimeDelta TimeMode = "delta"
+)
+
+// wallClockFormat is the format for TimeLocal and TimeUTC. The date is left
+// out, since it's rarely interesting when reading logs as they're written.
+const wallClockFormat = "15:04:05.000"
+
+// ParseTimeMode parses a TimeMode. An empty string is TimeElapsed.
+func ParseTimeMode(text string) (TimeMode, error) {
+	switch mode := TimeMode(strings.ToLower(strings.TrimSpace(text))); mode {
+	case "":
+		return TimeElapsed, nil
+	case TimeElapsed, TimeLocal, TimeUTC, TimeDelta:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unrecognized time mode: %q", text)
+	}
+}
+
+// DetectTimeMode returns the TimeMode based on the PS_LOG_TIME env var,
+// which is one of elapsed, local, utc or delta. Defaults to elapsed.
+func DetectTimeMode() TimeMode {
+	mode, err := ParseTimeMode(os.Getenv("PS_LOG_TIME"))
+	if err != nil {
+		panic("Invalid PS_LOG_TIME value: " + os.Getenv("PS_LOG_TIME"))
+	}
+	return mode
+}
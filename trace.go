@@ -0,0 +1,155 @@
+package log
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Keys used for the trace correlation fields added by Ctx and TraceFields.
+const (
+	TraceIDKey    = "trace_id"
+	SpanIDKey     = "span_id"
+	TraceFlagsKey = "trace_flags"
+)
+
+// TraceContext identifies the span which is active within a context.Context,
+// using the W3C Trace Context representation of each ID.
+type TraceContext struct {
+	TraceID    string
+	SpanID     string
+	TraceFlags byte
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler. This is used inline
+// so the trace fields are added at the top level of an entry, rather than
+// nested under their own key.
+func (tc TraceContext) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if p, ok := enc.(profiled); ok && p.appliedProfile().trace != nil {
+		p.appliedProfile().trace(enc, tc)
+		return nil
+	}
+	traceID, spanID := tc.TraceID, tc.SpanID
+	// Full IDs are noise when reading logs in a terminal, so the pretty
+	// encoder only shows enough of each ID to tell requests apart.
+	if _, ok := enc.(*prettyEncoder); ok {
+		traceID, spanID = shortenID(traceID), shortenID(spanID)
+	}
+	enc.AddString(TraceIDKey, traceID)
+	enc.AddString(SpanIDKey, spanID)
+	enc.AddString(TraceFlagsKey, traceFlagsString(tc.TraceFlags))
+	return nil
+}
+
+// rootTrace adds a TraceContext at the top level of an entry, even once a
+// namespace has been opened, which is how TraceFields adds it.
+type rootTrace struct {
+	TraceContext
+}
+
+func (rt rootTrace) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	switch enc := enc.(type) {
+	case rootTracer:
+		enc.setTrace(rt.TraceContext)
+		return nil
+	case *prettyEncoder:
+		defer enc.resetNamespace()()
+	case *logfmtEncoder:
+		defer enc.resetNamespace()()
+	case *zapcore.MapObjectEncoder:
+		// Fields holds the top level, whichever namespace is open.
+		root := zapcore.NewMapObjectEncoder()
+		rt.TraceContext.MarshalLogObject(root) //nolint:errcheck
+		for k, v := range root.Fields {
+			enc.Fields[k] = v
+		}
+		return nil
+	}
+	return rt.TraceContext.MarshalLogObject(enc)
+}
+
+// rootTracer is implemented by the encoders which write a TraceContext with
+// the entry, rather than where it was added.
+type rootTracer interface {
+	setTrace(tc TraceContext)
+}
+
+func shortenID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
+
+func traceFlagsString(flags byte) string {
+	s := strconv.FormatUint(uint64(flags), 16)
+	if len(s) == 1 {
+		s = "0" + s
+	}
+	return s
+}
+
+// TraceExtractor returns the TraceContext of the span active in ctx, and
+// whether there is one at all.
+type TraceExtractor func(ctx context.Context) (TraceContext, bool)
+
+// traceExtractor holds the registered TraceExtractor. This avoids depending
+// on any particular tracing library, so only services which actually
+// trace need to pull one in.
+var traceExtractor atomic.Value
+
+// SetTraceExtractor registers fn as the TraceExtractor used by Ctx and
+// TraceFields. For OpenTelemetry, this would look like:
+//
+//	log.SetTraceExtractor(func(ctx context.Context) (log.TraceContext, bool) {
+//		sc := trace.SpanContextFromContext(ctx)
+//		if !sc.IsValid() {
+//			return log.TraceContext{}, false
+//		}
+//		return log.TraceContext{
+//			TraceID:    sc.TraceID().String(),
+//			SpanID:     sc.SpanID().String(),
+//			TraceFlags: byte(sc.TraceFlags()),
+//		}, true
+//	})
+func SetTraceExtractor(fn TraceExtractor) {
+	traceExtractor.Store(fn)
+}
+
+// TraceFields returns the trace_id, span_id and trace_flags fields for the
+// span active in ctx. If no TraceExtractor is registered, or there's no
+// active span, no fields are returned. The fields are always added at the
+// top level of an entry, rather than in any namespace that's open.
+func TraceFields(ctx context.Context) []Field {
+	tc, ok := TraceContextFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return []Field{Inline(rootTrace{tc})}
+}
+
+// TraceContextFromContext returns the TraceContext of the span active in ctx
+// using the registered TraceExtractor.
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	fn, _ := traceExtractor.Load().(TraceExtractor)
+	if fn == nil {
+		return TraceContext{}, false
+	}
+	return fn(ctx)
+}
+
+// Ctx returns the Logger carried by ctx, as with FromContext, along with
+// the trace correlation fields of the span active in ctx. These are added
+// at the top level of each entry, even if the Logger has opened a
+// namespace:
+//
+//	log.Ctx(ctx).Info("fetched branch")
+func Ctx(ctx context.Context) *Logger {
+	logger := FromContext(ctx)
+	if fields := TraceFields(ctx); len(fields) > 0 {
+		return logger.With(fields...)
+	}
+	return logger
+}
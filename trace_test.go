@@ -0,0 +1,64 @@
+package log
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTraceFieldsNamespace(t *testing.T) {
+	tc := TraceContext{
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		SpanID:     "00f067aa0ba902b7",
+		TraceFlags: 1,
+	}
+	tests := []struct {
+		encoding string
+		// want is how the trace ID is written at the top level.
+		want string
+	}{
+		{JSONEncoding, `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`},
+		{LogfmtEncoding, ` trace_id=4bf92f3577b34da6a3ce929d0e0e4736`},
+		{PrettyEncoding, ` trace_id="4bf92f35"`},
+		{GCPEncoding, `"logging.googleapis.com/trace":"4bf92f3577b34da6a3ce929d0e0e4736"`},
+		{ECSEncoding, `"trace.id":"4bf92f3577b34da6a3ce929d0e0e4736"`},
+		{DatadogEncoding, `"dd.trace_id":"11803532876627986230"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.encoding, func(t *testing.T) {
+			enc := Config{Encoding: tt.encoding}.buildEncoder(&sinks{})
+			// As with a Logger which opened a namespace, and was then
+			// returned by Ctx.
+			addFields(enc, []Field{Namespace("req")})
+			addFields(enc, []Field{Inline(rootTrace{tc})})
+			buf, err := enc.EncodeEntry(zapcore.Entry{Message: "fetched"}, []Field{String("id", "1")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer buf.Free()
+			got := buf.String()
+			if !strings.Contains(got, tt.want) {
+				t.Errorf("got %q, want it to contain %q", got, tt.want)
+			}
+			if strings.Contains(got, "req.trace") || strings.Contains(got, `"req":{"trace`) {
+				t.Errorf("got %q, want the trace outside the namespace", got)
+			}
+		})
+	}
+}
+
+func TestTraceFieldsMapNamespace(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	addFields(enc, []Field{
+		Namespace("req"),
+		Inline(rootTrace{TraceContext{TraceID: "t", SpanID: "s"}}),
+		String("id", "1"),
+	})
+	if enc.Fields[TraceIDKey] != "t" || enc.Fields[SpanIDKey] != "s" {
+		t.Errorf("got %v, want the trace at the top level", enc.Fields)
+	}
+	if req, _ := enc.Fields["req"].(map[string]interface{}); req["id"] != "1" || len(req) != 1 {
+		t.Errorf("got req %v, want only the id", req)
+	}
+}